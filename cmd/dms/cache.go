@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/dms/pkg/library"
+	"github.com/Adirelle/dms/pkg/processor"
+	"github.com/Adirelle/dms/pkg/processor/ffprobe"
+	"github.com/Adirelle/dms/pkg/processor/subtitle"
+	"github.com/Adirelle/dms/pkg/processor/thumbnail"
+	"github.com/Adirelle/go-libs/dic"
+)
+
+var errCacheUsage = errors.New("usage: dms [flags] cache stats|verify|purge|compact")
+
+// cacheCommand runs the cache maintenance subcommands, printing their reports as JSON
+func cacheCommand(ctn *dic.Container, c *Container, args []string) (err error) {
+	if len(args) != 1 {
+		return errCacheUsage
+	}
+	if c.Config.CachePath == "" {
+		return errors.New("no cache database, use -cache")
+	}
+
+	switch args[0] {
+	case "stats", "verify", "purge":
+	case "compact":
+		// Must be done before the database is opened
+		err := cache.Compact(c.Config.CachePath)
+		if err == nil {
+			c.Logger.Infof("compacted %s", c.Config.CachePath)
+		}
+		return err
+	default:
+		return errCacheUsage
+	}
+	// Report the outdated buckets instead of upgrading them
+	c.readOnlyCache = args[0] != "purge"
+
+	var backend cache.Backend
+	if err = ctn.Fetch(&backend); err != nil {
+		return
+	}
+	defer backend.Close()
+
+	var h *cache.Handler
+	if err = ctn.Fetch(&h); err != nil {
+		return
+	}
+	// Fetch the owners of the caches so their buckets are known
+	var (
+		cd       *cds.Cache
+		ffprober *ffprobe.Processor
+		albumArt *processor.AlbumArtProcessor
+		subs     *subtitle.Processor
+		thumbs   *thumbnail.Processor
+		index    *library.Index
+	)
+	for _, ptr := range []interface{}{&cd, &ffprober, &albumArt, &subs, &thumbs, &index} {
+		if err = ctn.Fetch(ptr); err != nil {
+			return
+		}
+	}
+
+	var report interface{}
+	switch args[0] {
+	case "stats":
+		report, err = h.Stats()
+	case "verify":
+		report, err = h.Verify()
+	case "purge":
+		report, err = h.Purge()
+	}
+	if err != nil {
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func (c *Container) CacheHandler(cm *cache.Manager, fs *filesystem.Filesystem) *cache.Handler {
+	return cache.NewHandler(cm, cacheValidator(fs), c.logger("caches"))
+}
+
+// cacheValidator rejects the cached values that refer to files outside of the served directories
+func cacheValidator(fs *filesystem.Filesystem) cache.Validator {
+	return func(value interface{}) bool {
+		if i, ok := value.(interface{ Item() *filesystem.FileItem }); ok {
+			return fs.Contains(i.Item())
+		}
+		return true
+	}
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"net"
+	"strings"
+
+	"github.com/Adirelle/dms/pkg/filesystem"
 )
 
 type configFileVar struct{ c *Config }
@@ -23,6 +26,47 @@ func (c configFileVar) Set(path string) error {
 	return nil
 }
 
+// rootsVar accumulates the directories to serve, given as either "path" or "name=path".
+// The first occurrence replaces the roots read from the configuration file.
+type rootsVar struct {
+	c     *Config
+	isSet bool
+}
+
+func (r *rootsVar) String() string {
+	if r.c == nil {
+		return ""
+	}
+	if len(r.c.Roots) == 0 {
+		return r.c.Root
+	}
+	parts := make([]string, len(r.c.Roots))
+	for i, root := range r.c.Roots {
+		parts[i] = root.Name + "=" + root.Path
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *rootsVar) Get() interface{} {
+	return r.c.Roots
+}
+
+func (r *rootsVar) Set(value string) error {
+	if !r.isSet {
+		r.c.Roots = nil
+		r.isSet = true
+	}
+	root := filesystem.Root{Path: value}
+	if parts := strings.SplitN(value, "=", 2); len(parts) == 2 {
+		root.Name, root.Path = parts[0], parts[1]
+	}
+	if root.Path == "" {
+		return fmt.Errorf("empty path in %q", value)
+	}
+	r.c.Roots = append(r.c.Roots, root)
+	return nil
+}
+
 type tcpAddrVar struct{ Addr *net.TCPAddr }
 
 func (t *tcpAddrVar) String() string {
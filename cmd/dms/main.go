@@ -20,19 +20,25 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Adirelle/dms/pkg/archive"
 	"github.com/Adirelle/dms/pkg/cache"
 	"github.com/Adirelle/dms/pkg/cds"
 	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/dms/pkg/library"
+	"github.com/Adirelle/dms/pkg/playlist"
 	"github.com/Adirelle/dms/pkg/processor"
 	"github.com/Adirelle/dms/pkg/processor/basic_icon"
 	"github.com/Adirelle/dms/pkg/processor/ffprobe"
+	"github.com/Adirelle/dms/pkg/processor/subtitle"
+	"github.com/Adirelle/dms/pkg/processor/thumbnail"
+	"github.com/Adirelle/dms/pkg/processor/transcode"
+	"github.com/Adirelle/dms/pkg/renderer"
 	"github.com/Adirelle/dms/pkg/rest"
 	"github.com/Adirelle/dms/pkg/ssdp"
 	"github.com/Adirelle/dms/pkg/upnp"
 	"github.com/Adirelle/go-libs/dic"
 	adi_http "github.com/Adirelle/go-libs/http"
 	"github.com/Adirelle/go-libs/logging"
-	bolt "github.com/coreos/bbolt"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/satori/go.uuid"
@@ -54,8 +60,12 @@ const (
 func main() {
 
 	config := &Config{
-		FriendlyName:   getDefaultFriendlyName(),
-		Config:         filesystem.Config{Root: "."},
+		FriendlyName: getDefaultFriendlyName(),
+		Config: filesystem.Config{
+			Root:         ".",
+			Watch:        filesystem.WatchAuto,
+			PollInterval: filesystem.DefaultPollInterval,
+		},
 		Interface:      Interface{},
 		NotifyInterval: 30 * time.Minute,
 		HTTP:           tcpAddrVar{&net.TCPAddr{Port: 1338}},
@@ -64,6 +74,37 @@ func main() {
 			BinPath: "ffprobe",
 			Limit:   20,
 		},
+		Transcode: transcode.Config{
+			BinPath:  "ffmpeg",
+			Limit:    4,
+			Profiles: transcode.DefaultProfiles,
+		},
+		Subtitles: subtitle.Config{
+			BinPath: "ffmpeg",
+			VTT:     true,
+		},
+		Thumbnails: thumbnail.Config{
+			BinPath: "ffmpeg",
+		},
+		Renderers: renderer.DefaultProfiles,
+		AlbumArt: processor.AlbumArtConfig{
+			Patterns: processor.DefaultAlbumArtPatterns,
+			PerItem:  true,
+		},
+		Music: true,
+		Library: library.Config{
+			Scan:        true,
+			Concurrency: library.DefaultConcurrency,
+			Recent:      library.DefaultRecent,
+		},
+		Playlists: playlist.Config{
+			Generate: true,
+		},
+		Archives: archive.Config{
+			Enabled: true,
+		},
+		CacheSize:  10000,
+		CacheRetry: cache.DefaultFailureTTL,
 	}
 
 	dumpConfig := false
@@ -86,7 +127,7 @@ func main() {
 	l.Infof("DMS #%s, build on %s", CommitRef, BuildDate)
 
 	ctn := dic.New()
-	inner := &Container{config, lf.Get("container"), lf}
+	inner := &Container{Config: config, Logger: lf.Get("container"), LoggerFactory: lf}
 
 	ctnLogger, err := inner.Logger.StdLoggerAt(logging.DebugLevel)
 	if err != nil {
@@ -96,13 +137,19 @@ func main() {
 
 	ctn.RegisterFrom(inner)
 
-	var db *bolt.DB
-	if err = ctn.Fetch(&db); db != nil {
-		l.Infof("using cache storage: %s", db.Path())
+	if flag.NArg() != 0 {
+		if err = cacheCommand(ctn, inner, flag.Args()[1:]); err != nil {
+			l.Fatal(err)
+		}
+		return
+	}
+
+	var backend cache.Backend
+	if err = ctn.Fetch(&backend); backend != nil {
+		l.Infof("using cache storage: %s", backend)
 		defer func() {
 			l.Infof("Closing cache storage")
-			db.Sync()
-			db.Close()
+			backend.Close()
 		}()
 	} else if err != nil {
 		l.Fatal(err)
@@ -130,20 +177,35 @@ func main() {
 type Config struct {
 	FriendlyName string `json:"friendlyName"`
 	filesystem.Config
-	Logging        logging.Config `json:"logging"`
-	Interface      Interface      `json:"ifname"`
-	HTTP           tcpAddrVar     `json:"http"`
-	AccessLog      string         `json:"accessLog"`
-	NotifyInterval time.Duration  `json:"notifyInterval"`
-	Debug          bool           `json:"debug"`
-	FFProbe        ffprobe.Config `json:"ffProbe"`
-	CachePath      string         `json:"cachePath"`
+	Logging        logging.Config           `json:"logging"`
+	Interface      Interface                `json:"ifname"`
+	HTTP           tcpAddrVar               `json:"http"`
+	AccessLog      string                   `json:"accessLog"`
+	NotifyInterval time.Duration            `json:"notifyInterval"`
+	Debug          bool                     `json:"debug"`
+	FFProbe        ffprobe.Config           `json:"ffProbe"`
+	Transcode      transcode.Config         `json:"transcode"`
+	Subtitles      subtitle.Config          `json:"subtitles"`
+	Thumbnails     thumbnail.Config         `json:"thumbnails"`
+	Renderers      []renderer.Profile       `json:"renderers"`
+	AlbumArt       processor.AlbumArtConfig `json:"albumArt"`
+	Music          bool                     `json:"music"`
+	Library        library.Config           `json:"library"`
+	Playlists      playlist.Config          `json:"playlists"`
+	Archives       archive.Config           `json:"archives"`
+	CachePath      string                   `json:"cachePath"`
+	CacheSize      int                      `json:"cacheSize"`
+	CacheLimits    map[string]cache.Limit   `json:"cacheLimits,omitempty"`
+	CacheTTLs      map[string]time.Duration `json:"cacheTTLs,omitempty"`
+	CacheRetry     time.Duration            `json:"cacheRetry"`
 }
 
 func (c *Config) SetupFlags() {
 	flag.Var(configFileVar{c}, "config", "path to the json configuration file")
 
-	flag.StringVar(&c.Root, "path", c.Root, "path to the directory to serve")
+	flag.Var(&rootsVar{c: c}, "path", "directory to serve, as path or name=path; repeat to serve several directories")
+	flag.StringVar(&c.Watch, "watch", c.Watch, "how to detect changes: auto, inotify, poll or none")
+	flag.DurationVar(&c.PollInterval, "pollInterval", c.PollInterval, "interval between filesystem scans when polling")
 	flag.Var(&c.HTTP, "http", "http server port")
 	flag.Var(&c.Interface, "ifname", "name of the network interface to bind to")
 	flag.StringVar(&c.FriendlyName, "friendlyName", c.FriendlyName, "server friendly name")
@@ -156,17 +218,32 @@ func (c *Config) SetupFlags() {
 	flag.Var(&c.Logging.Level, "level", "set logging levels")
 	flag.BoolVar(&c.Logging.Quiet, "quiet", c.Logging.Quiet, "only show errors")
 
-	flag.StringVar(&c.CachePath, "cache", "", "path to the cache database")
+	flag.StringVar(&c.CachePath, "cache", "", "path or URL of the cache database: bolt:///path (default), sqlite:///path, redis://host[:port][/db] or mem://name")
+	flag.IntVar(&c.CacheSize, "cacheSize", c.CacheSize, "maximum number of entries of each in-memory cache, 0 for no limit")
+	flag.DurationVar(&c.CacheRetry, "cacheRetry", c.CacheRetry, "initial delay before retrying to probe a file that failed, doubled on each failure")
 
 	flag.StringVar(&c.FFProbe.BinPath, "ffprobe", "ffprobe", "path to the ffprobe executable")
 	flag.UintVar(&c.FFProbe.Limit, "ffprobeLimit", 20, "maximum number of concurrent ffprobes")
+
+	flag.StringVar(&c.Transcode.BinPath, "ffmpeg", c.Transcode.BinPath, "path to the ffmpeg executable, empty to disable transcoding")
+	flag.UintVar(&c.Transcode.Limit, "transcodeLimit", c.Transcode.Limit, "maximum number of concurrent transcodings")
+	flag.BoolVar(&c.Subtitles.VTT, "vtt", c.Subtitles.VTT, "offer WebVTT versions of SubRip subtitles")
+	flag.BoolVar(&c.Music, "music", c.Music, "add the Music container, browsing the audio files by artist, album, genre and year")
+	flag.BoolVar(&c.Library.Scan, "scan", c.Library.Scan, "scan the music library in the background")
+	flag.IntVar(&c.Library.Concurrency, "scanConcurrency", c.Library.Concurrency, "maximum number of files processed concurrently by the library scan")
+	flag.IntVar(&c.Library.Recent, "recent", c.Library.Recent, "number of items of the recently added and recently played containers, 0 to disable them")
+	flag.BoolVar(&c.Playlists.Remote, "remotePlaylistItems", c.Playlists.Remote, "expose the http(s) URLs of the playlist files as items")
+	flag.BoolVar(&c.Playlists.Generate, "containerPlaylists", c.Playlists.Generate, "offer M3U8 and XSPF playlists of the containers")
+	flag.BoolVar(&c.Playlists.Recursive, "recursivePlaylists", c.Playlists.Recursive, "include the items of the subcontainers in the playlists of the containers")
+	flag.BoolVar(&c.Archives.Enabled, "archives", c.Archives.Enabled, "browse the ZIP, CBZ and TAR archives as directories")
+	flag.BoolVar(&c.AlbumArt.Hide, "hideCovers", c.AlbumArt.Hide, "hide the album art files from the directory listings")
 }
 
 func (c *Config) ParseArgs() {
 	c.SetupFlags()
 
 	flag.Parse()
-	if flag.NArg() != 0 {
+	if flag.NArg() != 0 && flag.Arg(0) != "cache" {
 		flag.Usage()
 		log.Fatalf("%s: %s\n", "unexpected positional arguments", flag.Args())
 	}
@@ -226,6 +303,8 @@ type Container struct {
 	Config        *Config
 	Logger        logging.Logger
 	LoggerFactory *logging.Factory
+	// readOnlyCache leaves the cache database untouched, for the inspection commands
+	readOnlyCache bool
 }
 
 func (c *Container) logger(name string) logging.Logger {
@@ -237,11 +316,17 @@ type SSDPService suture.Service
 func (c *Container) Supervisor(
 	http *adi_http.Service,
 	ssdp ssdp.Service,
+	watcher *filesystem.Watcher,
+	scanner *library.Scanner,
 ) *suture.Supervisor {
 	l := c.logger("supervisor")
 	spv := suture.New("dms", suture.Spec{Log: func(m string) { l.Warn(m) }})
 	spv.Add(http)
 	spv.Add(ssdp)
+	spv.Add(watcher)
+	if scanner != nil {
+		spv.Add(scanner)
+	}
 	return spv
 }
 
@@ -265,6 +350,13 @@ func (c *Container) Router(
 	cd cds.ContentDirectory,
 	fserver *cds.FileServer,
 	iconer *basic_icon.Processor,
+	transcoder *transcode.Processor,
+	subtitles *subtitle.Processor,
+	thumbnails *thumbnail.Processor,
+	renderers *renderer.Matcher,
+	scanner *library.Scanner,
+	playlists *playlist.Generator,
+	caches *cache.Handler,
 	al AccessLog,
 ) (r *mux.Router, err error) {
 	r = mux.NewRouter()
@@ -294,6 +386,24 @@ func (c *Container) Router(
 		return
 	}
 
+	if scanner != nil {
+		err = r.Methods("GET").Path("/library/progress").
+			Name(library.ProgressRoute).
+			Handler(scanner).
+			GetError()
+		if err != nil {
+			return
+		}
+	}
+
+	err = r.Methods("GET", "POST").Path("/cache/" + cache.RouteOperationTemplate).
+		Name(cache.MaintenanceRoute).
+		Handler(caches).
+		GetError()
+	if err != nil {
+		return
+	}
+
 	err = r.Methods("GET", "HEAD").Path("/files" + cds.RouteObjectIDTemplate).
 		Name(cds.FileServerRoute).
 		Handler(fserver).
@@ -302,6 +412,58 @@ func (c *Container) Router(
 		return
 	}
 
+	if playlists != nil {
+		err = r.Methods("GET", "HEAD").Path("/playlists/" + playlist.RouteFormatTemplate + cds.RouteObjectIDTemplate).
+			Name(playlist.GeneratorRoute).
+			Handler(playlists).
+			GetError()
+		if err != nil {
+			return
+		}
+	}
+
+	err = r.Methods("GET", "HEAD").Path("/thumbnails" + cds.RouteObjectIDTemplate).
+		Name(thumbnail.ThumbnailRoute).
+		Handler(thumbnails).
+		GetError()
+	if err != nil {
+		return
+	}
+
+	err = r.Methods("GET", "HEAD").Path("/covers" + cds.RouteObjectIDTemplate).
+		Name(thumbnail.CoverRoute).
+		Handler(thumbnails.CoverHandler()).
+		GetError()
+	if err != nil {
+		return
+	}
+
+	err = r.Methods("GET", "HEAD").Path("/subtitles/file/" + subtitle.RouteFormatTemplate + cds.RouteObjectIDTemplate).
+		Name(subtitle.FileRoute).
+		Handler(subtitles).
+		GetError()
+	if err != nil {
+		return
+	}
+
+	err = r.Methods("GET", "HEAD").Path("/subtitles/stream/" + subtitle.RouteFormatTemplate + "/" + subtitle.RouteStreamTemplate + cds.RouteObjectIDTemplate).
+		Name(subtitle.StreamRoute).
+		Handler(subtitles).
+		GetError()
+	if err != nil {
+		return
+	}
+
+	if transcoder != nil {
+		err = r.Methods("GET", "HEAD").Path("/transcode/" + transcode.RouteProfileTemplate + cds.RouteObjectIDTemplate).
+			Name(transcode.TranscodeRoute).
+			Handler(transcoder).
+			GetError()
+		if err != nil {
+			return
+		}
+	}
+
 	err = r.Methods("GET", "HEAD").Path("/").
 		Handler(http.RedirectHandler("/rest/", http.StatusSeeOther)).
 		GetError()
@@ -313,6 +475,7 @@ func (c *Container) Router(
 	r.Use(adi_http.UniqueID)
 	r.Use(adi_http.DebugRequest)
 	r.Use(adi_http.AddURLGenerator(r))
+	r.Use(renderers.Middleware)
 
 	if al != nil {
 		r.Use(func(next http.Handler) http.Handler {
@@ -331,6 +494,10 @@ func (c *Container) Router(
 	return
 }
 
+func (c *Container) RendererMatcher() (*renderer.Matcher, error) {
+	return renderer.NewMatcher(c.Config.Renderers)
+}
+
 func (c *Container) AccessLog() (al AccessLog) {
 	fpath := c.Config.AccessLog
 	if fpath == "-" {
@@ -403,18 +570,114 @@ func (c *Container) UDN() UDN {
 	return UDN(fmt.Sprintf("uuid:%s", uuid.NewV5(uuid.NamespaceX500, c.Config.FriendlyName)))
 }
 
-func (c *Container) CDService(dir cds.ContentDirectory) *cds.Service {
-	return cds.NewService(dir)
+func (c *Container) CDService(dir cds.ContentDirectory, cache *cds.Cache) (*cds.Service, error) {
+	s, err := cds.NewService(dir)
+	if err != nil {
+		return nil, err
+	}
+	s.SearchDirectory = cache
+	return s, nil
+}
+
+func (c *Container) FileServer(
+	dir *cds.FilesystemContentDirectory,
+	transcoder *transcode.Processor,
+	subtitles *subtitle.Processor,
+	index *library.Index,
+	lister *archive.Lister,
+) *cds.FileServer {
+	var fs *cds.FileServer
+	if c.Config.Archives.Enabled {
+		archives := &archive.Directory{ContentDirectory: dir, Lister: lister}
+		fs = cds.NewFileServer(archives)
+		fs.Opener = archives
+	} else {
+		fs = cds.NewFileServer(dir)
+	}
+	fs.Captions = subtitles
+	if transcoder != nil {
+		fs.TimeSeeker = transcoder
+	}
+	if index != nil {
+		fs.History = index
+	}
+	return fs
 }
 
-func (c *Container) FileServer(dir *cds.FilesystemContentDirectory) *cds.FileServer {
-	return cds.NewFileServer(dir)
+func (c *Container) ContentDirectory(
+	cache *cds.Cache,
+	fs *filesystem.Filesystem,
+	index *library.Index,
+	ffprober *ffprobe.Processor,
+	lister *archive.Lister,
+	parser *playlist.Parser,
+) cds.ContentDirectory {
+	var base cds.ContentDirectory = cache
+	if c.Config.Archives.Enabled {
+		base = &archive.Directory{ContentDirectory: cache, Lister: lister}
+	}
+	playlists := &playlist.Directory{
+		ContentDirectory: base,
+		FS:               fs,
+		Remote:           c.Config.Playlists.Remote,
+		Parser:           parser,
+	}
+	var d cds.ContentDirectory = playlists
+	if index != nil {
+		d = &library.Directory{
+			ContentDirectory: playlists,
+			Index:            index,
+			Music:            c.musicEnabled(ffprober),
+			Recent:           c.Config.Library.Recent,
+		}
+	}
+	if c.Config.Playlists.Generate {
+		d = &playlist.GeneratorDirectory{ContentDirectory: d}
+	}
+	return d
+}
+
+func (c *Container) ArchiveLister(cf *cache.Manager) *archive.Lister {
+	if !c.Config.Archives.Enabled {
+		return nil
+	}
+	return archive.NewLister(cf)
 }
 
-func (c *Container) ContentDirectory(dir *cds.ProcessingDirectory, cf *cache.Manager) cds.ContentDirectory {
+func (c *Container) PlaylistParser(cf *cache.Manager) *playlist.Parser {
+	return playlist.NewParser(cf)
+}
+
+func (c *Container) PlaylistGenerator(cd cds.ContentDirectory) *playlist.Generator {
+	if !c.Config.Playlists.Generate {
+		return nil
+	}
+	return playlist.NewGenerator(cd, c.Config.Playlists.Recursive, c.logger("playlists"))
+}
+
+// musicEnabled returns true if the music views are enabled and can be built
+func (c *Container) musicEnabled(ffprober *ffprobe.Processor) bool {
+	return c.Config.Music && ffprober != nil
+}
+
+func (c *Container) CacheDirectory(dir *cds.ProcessingDirectory, cf *cache.Manager) *cds.Cache {
 	return cds.NewCache(dir, cf, c.logger("cd-cache"))
 }
 
+func (c *Container) LibraryIndex(cm *cache.Manager, ffprober *ffprobe.Processor) (*library.Index, error) {
+	if !c.musicEnabled(ffprober) && c.Config.Library.Recent <= 0 {
+		return nil, nil
+	}
+	return library.NewIndex(cm, c.logger("library"))
+}
+
+func (c *Container) LibraryScanner(cache *cds.Cache, index *library.Index) *library.Scanner {
+	if index == nil {
+		return nil
+	}
+	return library.NewScanner(c.Config.Library, cache, index, c.logger("library"))
+}
+
 func (c *Container) ProcessingDirectory(
 	dir *cds.FilesystemContentDirectory,
 	fs *filesystem.Filesystem,
@@ -422,6 +685,10 @@ func (c *Container) ProcessingDirectory(
 	ffprober *ffprobe.Processor,
 	albumArt *processor.AlbumArtProcessor,
 	iconer *basic_icon.Processor,
+	transcoder *transcode.Processor,
+	subtitles *subtitle.Processor,
+	thumbnails *thumbnail.Processor,
+	index *library.Index,
 ) (d *cds.ProcessingDirectory) {
 	d = &cds.ProcessingDirectory{ContentDirectory: dir, Logger: c.logger("processing")}
 
@@ -429,10 +696,25 @@ func (c *Container) ProcessingDirectory(
 	d.AddProcessor(95, albumArt)
 	d.AddProcessor(90, iconer)
 
+	if transcoder != nil {
+		d.AddProcessor(85, transcoder)
+	}
+
 	if ffprober != nil {
 		d.AddProcessor(80, ffprober)
 	}
 
+	d.AddProcessor(75, subtitles)
+	d.AddProcessor(70, thumbnails)
+
+	if index != nil {
+		// Last, so all the metadata are available
+		d.AddProcessor(0, index)
+	}
+
+	d.AddHider(subtitles)
+	d.AddHider(albumArt)
+
 	return
 }
 
@@ -450,12 +732,43 @@ func (c *Container) FFProbeProcessor(cf *cache.Manager) (p *ffprobe.Processor) {
 	return
 }
 
+func (c *Container) TranscodeProcessor(dir *cds.FilesystemContentDirectory, ffprober *ffprobe.Processor) (p *transcode.Processor) {
+	if c.Config.Transcode.BinPath == "" {
+		return nil
+	}
+
+	l := c.logger("transcode")
+	p, err := transcode.NewProcessor(c.Config.Transcode, dir, ffprober, l)
+	if err != nil {
+		l.Errorf("cannot initialize transcoding: %s", err.Error())
+	}
+
+	return
+}
+
+func (c *Container) SubtitleProcessor(
+	dir *cds.FilesystemContentDirectory,
+	fs *filesystem.Filesystem,
+	ffprober *ffprobe.Processor,
+	cf *cache.Manager,
+) *subtitle.Processor {
+	return subtitle.NewProcessor(c.Config.Subtitles, dir, fs, ffprober, cf, c.logger("subtitles"))
+}
+
+func (c *Container) ThumbnailProcessor(
+	dir *cds.FilesystemContentDirectory,
+	ffprober *ffprobe.Processor,
+	cf *cache.Manager,
+) *thumbnail.Processor {
+	return thumbnail.NewProcessor(c.Config.Thumbnails, dir, ffprober, cf, c.logger("thumbnails"))
+}
+
 func (c *Container) BasicIconProcessor() *basic_icon.Processor {
 	return &basic_icon.Processor{}
 }
 
 func (c *Container) AlbumArtProcessor(fs *filesystem.Filesystem, cf *cache.Manager) *processor.AlbumArtProcessor {
-	return processor.NewAlbumArtProcessor(fs, cf, c.logger("album-art"))
+	return processor.NewAlbumArtProcessor(c.Config.AlbumArt, fs, cf, c.logger("album-art"))
 }
 
 func (c *Container) FilesystemContentDirectory(fs *filesystem.Filesystem) *cds.FilesystemContentDirectory {
@@ -470,17 +783,52 @@ func (c *Container) Filesystem() (fs *filesystem.Filesystem, err error) {
 	return
 }
 
-func (c *Container) CacheManager(db *bolt.DB) *cache.Manager {
+func (c *Container) FilesystemWatcher(
+	fs *filesystem.Filesystem,
+	cache *cds.Cache,
+	cdService *cds.Service,
+	scanner *library.Scanner,
+	albumArt *processor.AlbumArtProcessor,
+	subtitles *subtitle.Processor,
+	thumbnails *thumbnail.Processor,
+	ffprober *ffprobe.Processor,
+) *filesystem.Watcher {
+	w := filesystem.NewWatcher(fs, c.Config.Config, c.logger("watcher"))
+	w.OnChange(cache.Invalidate)
+	w.OnChange(albumArt.Invalidate)
+	w.OnChange(subtitles.Invalidate)
+	w.OnChange(func(ids []filesystem.ID) {
+		for _, id := range ids {
+			if path, err := fs.FilePath(id); err == nil {
+				if ffprober != nil {
+					ffprober.Invalidate(path)
+				}
+				thumbnails.Invalidate(path)
+			}
+		}
+	})
+	if scanner != nil {
+		w.OnChange(scanner.Invalidate)
+	}
+	w.OnChange(cdService.ObjectsChanged)
+	return w
+}
+
+func (c *Container) CacheManager(backend cache.Backend) *cache.Manager {
 	return &cache.Manager{
-		DB:   db,
-		Size: 10000,
-		L:    c.logger("caches"),
+		Backend:    backend,
+		Size:       c.Config.CacheSize,
+		Limits:     c.Config.CacheLimits,
+		TTLs:       c.Config.CacheTTLs,
+		FailureTTL: c.Config.CacheRetry,
+		ReadOnly:   c.readOnlyCache,
+		L:          c.logger("caches"),
 	}
 }
 
-func (c *Container) CacheDB() (*bolt.DB, error) {
+func (c *Container) CacheBackend() (cache.Backend, error) {
 	if c.Config.CachePath == "" {
 		return nil, nil
 	}
-	return bolt.Open(c.Config.CachePath, 0600, nil)
+	return cache.Open(c.Config.CachePath)
 }
@@ -0,0 +1,347 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxBufferedSize is the maximum size of the compressed entries that are loaded in memory to be seekable.
+	// The larger ones are streamed, without range support.
+	MaxBufferedSize = 16 << 20
+	// MaxBufferedTotal is the maximum size of the entries loaded in memory at once, by all the requests.
+	// Past it, the entries are streamed too.
+	MaxBufferedTotal = 4 * MaxBufferedSize
+)
+
+// buffered is the size of the entries currently loaded in memory
+var buffered struct {
+	size int64
+	mu   sync.Mutex
+}
+
+// formats maps the archive extensions, in lower case, to their formats
+var formats = map[string]string{
+	".zip":    "zip",
+	".cbz":    "zip",
+	".tar":    "tar",
+	".cbt":    "tar",
+	".tgz":    "tar.gz",
+	".tar.gz": "tar.gz",
+}
+
+// Format returns the format of an archive, or an empty string if the name is not a supported archive
+func Format(name string) string {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".tar.gz") {
+		return formats[".tar.gz"]
+	}
+	return formats[path.Ext(lower)]
+}
+
+// entry is a file or a directory of an archive
+type entry struct {
+	// name is the slash-separated path of the entry in the archive, without leading nor trailing slash
+	name    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+	// seekable is true if the content can be read at random
+	seekable bool
+}
+
+// listing describes the contents of an archive
+type listing struct {
+	entries map[string]*entry
+	// children lists the names of the direct children of the directories, "" being the top level
+	children map[string][]string
+}
+
+func newListing() *listing {
+	return &listing{
+		entries:  make(map[string]*entry),
+		children: make(map[string][]string),
+	}
+}
+
+// add adds an entry, and its missing parent directories
+func (l *listing) add(e *entry) {
+	name := cleanName(e.name)
+	if name == "" || hiddenName(name) {
+		return
+	}
+	e.name = name
+	if old, found := l.entries[name]; found {
+		if old.isDir && e.isDir {
+			return
+		}
+	} else {
+		dir := path.Dir(name)
+		if dir == "." {
+			dir = ""
+		} else {
+			l.add(&entry{name: dir, isDir: true, modTime: e.modTime})
+		}
+		l.children[dir] = append(l.children[dir], name)
+	}
+	l.entries[name] = e
+}
+
+// sort sorts the children by name
+func (l *listing) sort() {
+	for _, names := range l.children {
+		sort.Strings(names)
+	}
+}
+
+func cleanName(name string) string {
+	name = path.Clean("/" + strings.Replace(name, `\`, "/", -1))
+	return strings.TrimPrefix(name, "/")
+}
+
+// hiddenName returns true for the hidden entries and the metadata added by some archivers
+func hiddenName(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" || part == "Thumbs.db" {
+			return true
+		}
+	}
+	return false
+}
+
+// list reads the contents of an archive
+func list(filePath, format string) (*listing, error) {
+	l := newListing()
+	err := walk(filePath, format, func(e *entry, _ func() (io.ReadCloser, error)) bool {
+		l.add(e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.sort()
+	return l, nil
+}
+
+// open opens the entry of an archive. The returned reader implements io.Seeker when the archive allows it,
+// or when the entry is small enough to be loaded in memory.
+func open(filePath, format, name string) (rc io.ReadCloser, err error) {
+	found := false
+	var openErr error
+	err = walk(filePath, format, func(e *entry, opener func() (io.ReadCloser, error)) bool {
+		if e.isDir || cleanName(e.name) != name {
+			return true
+		}
+		found = true
+		if rc, openErr = opener(); openErr == nil {
+			rc, openErr = seekable(rc, e.size)
+		}
+		return false
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case openErr != nil:
+		return nil, openErr
+	case !found:
+		return nil, os.ErrNotExist
+	}
+	return
+}
+
+// walkFunc is called for each entry of an archive, with a function to open it which is only valid during the call.
+// The walk stops when it returns false.
+type walkFunc func(*entry, func() (io.ReadCloser, error)) bool
+
+// walk calls fn for each entry of an archive. The archive is closed on return, unless an entry has been
+// opened, in which case closing the entry closes the archive.
+func walk(filePath, format string, fn walkFunc) (err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	a := &openArchive{closers: []io.Closer{f}}
+	defer func() {
+		if !a.kept {
+			a.Close()
+		}
+	}()
+	switch format {
+	case "zip":
+		return walkZip(f, a, fn)
+	case "tar":
+		return walkTar(f, f, a, fn)
+	case "tar.gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		a.closers = append(a.closers, gz)
+		return walkTar(gz, nil, a, fn)
+	}
+	return os.ErrInvalid
+}
+
+// walkZip walks a zip archive. The stored entries are read directly from f, so they can be seeked.
+func walkZip(f *os.File, a *openArchive, fn walkFunc) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	for _, zf := range r.File {
+		zf := zf
+		e := &entry{
+			name:    zf.Name,
+			isDir:   zf.FileInfo().IsDir(),
+			size:    int64(zf.UncompressedSize64),
+			modTime: zf.Modified,
+		}
+		e.seekable = zf.Method == zip.Store || e.size <= MaxBufferedSize
+		opener := func() (io.ReadCloser, error) {
+			if zf.Method == zip.Store {
+				offset, err := zf.DataOffset()
+				if err != nil {
+					return nil, err
+				}
+				return a.keep(io.NewSectionReader(f, offset, e.size)), nil
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+			a.closers = append(a.closers, rc)
+			return a.keep(rc), nil
+		}
+		if !fn(e, opener) {
+			break
+		}
+	}
+	return nil
+}
+
+// walkTar walks a tar archive. If f is not nil, it is the underlying file of r, so the entries can be seeked.
+func walkTar(r io.Reader, f *os.File, a *openArchive, fn walkFunc) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+		e := &entry{
+			name:    hdr.Name,
+			isDir:   hdr.Typeflag == tar.TypeDir,
+			size:    hdr.Size,
+			modTime: hdr.ModTime,
+		}
+		e.seekable = f != nil || e.size <= MaxBufferedSize
+		opener := func() (io.ReadCloser, error) {
+			if f == nil {
+				return a.keep(tr), nil
+			}
+			// The tar reader does not read ahead, the file is at the beginning of the entry
+			offset, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			return a.keep(io.NewSectionReader(f, offset, e.size)), nil
+		}
+		if !fn(e, opener) {
+			return nil
+		}
+	}
+}
+
+// openArchive holds the resources of an archive being read
+type openArchive struct {
+	closers []io.Closer
+	kept    bool
+}
+
+// keep returns a ReadCloser closing the archive
+func (a *openArchive) keep(r io.Reader) io.ReadCloser {
+	a.kept = true
+	if s, ok := r.(*io.SectionReader); ok {
+		return sectionReadCloser{s, a}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, a}
+}
+
+// Close closes the resources, in reverse order
+func (a *openArchive) Close() (err error) {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if e := a.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// bytesReadCloser releases its size from the buffering budget on close
+type bytesReadCloser struct {
+	*bytes.Reader
+	size  int64
+	close sync.Once
+}
+
+func (b *bytesReadCloser) Close() error {
+	b.close.Do(func() { releaseBuffer(b.size) })
+	return nil
+}
+
+// seekable loads the small non-seekable readers in memory, as long as MaxBufferedTotal is not reached
+func seekable(rc io.ReadCloser, size int64) (io.ReadCloser, error) {
+	if _, ok := rc.(io.Seeker); ok || size > MaxBufferedSize || !reserveBuffer(size) {
+		return rc, nil
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, size))
+	if err != nil {
+		releaseBuffer(size)
+		return nil, err
+	}
+	return &bytesReadCloser{Reader: bytes.NewReader(data), size: size}, nil
+}
+
+// reserveBuffer returns true if size bytes can be loaded in memory
+func reserveBuffer(size int64) bool {
+	buffered.mu.Lock()
+	defer buffered.mu.Unlock()
+	if buffered.size+size > MaxBufferedTotal {
+		return false
+	}
+	buffered.size += size
+	return true
+}
+
+func releaseBuffer(size int64) {
+	buffered.mu.Lock()
+	buffered.size -= size
+	buffered.mu.Unlock()
+}
@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testFiles = map[string]string{
+	"page01.jpg":          "first page",
+	"extra/page02.jpg":    "second page",
+	"__MACOSX/._page.jpg": "metadata",
+}
+
+func TestFormat(t *testing.T) {
+	var data = map[string]string{
+		"comic.CBZ":      "zip",
+		"photos.zip":     "zip",
+		"backup.tar":     "tar",
+		"backup.tar.gz":  "tar.gz",
+		"backup.tgz":     "tar.gz",
+		"song.mp3":       "",
+		"archive.gz":     "",
+		"/dir.zip/a.txt": "",
+	}
+	for name, expected := range data {
+		if actual := Format(name); actual != expected {
+			t.Errorf("Format(%q), expected %q, got %q", name, expected, actual)
+		}
+	}
+}
+
+func TestArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The small compressed entries are loaded in memory, so all of them can be seeked
+	var data = []string{
+		writeZip(t, filepath.Join(dir, "stored.cbz"), zip.Store),
+		writeZip(t, filepath.Join(dir, "deflated.zip"), zip.Deflate),
+		writeTar(t, filepath.Join(dir, "plain.tar")),
+	}
+	for _, filePath := range data {
+		l, err := list(filePath, Format(filePath))
+		if err != nil {
+			t.Errorf("list(%q): unexpected error: %s", filePath, err)
+			continue
+		}
+		if expected := []string{"extra", "page01.jpg"}; !reflect.DeepEqual(l.children[""], expected) {
+			t.Errorf("list(%q), expected %q, got %q", filePath, expected, l.children[""])
+		}
+		if e := l.entries["extra"]; e == nil || !e.isDir {
+			t.Errorf("list(%q), expected the directory entry %q", filePath, "extra")
+		}
+
+		rc, err := open(filePath, Format(filePath), "extra/page02.jpg")
+		if err != nil {
+			t.Errorf("open(%q): unexpected error: %s", filePath, err)
+			continue
+		}
+		if _, ok := rc.(io.Seeker); !ok {
+			t.Errorf("open(%q), expected a seekable reader", filePath)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(content) != testFiles["extra/page02.jpg"] {
+			t.Errorf("open(%q), expected %q, got %q (%v)", filePath, testFiles["extra/page02.jpg"], content, err)
+		}
+
+		if _, err := open(filePath, Format(filePath), "missing.jpg"); !os.IsNotExist(err) {
+			t.Errorf("open(%q), expected a not-exist error, got %v", filePath, err)
+		}
+	}
+}
+
+func writeZip(t *testing.T, filePath string, method uint16) string {
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range testFiles {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err == nil {
+			_, err = io.WriteString(w, content)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func writeTar(t *testing.T, filePath string) string {
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for name, content := range testFiles {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.WriteString(tw, content)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestBufferingLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := writeZip(t, filepath.Join(dir, "deflated.zip"), zip.Deflate)
+
+	if !reserveBuffer(MaxBufferedTotal) {
+		t.Fatal("expected the buffers to be available")
+	}
+	rc, err := open(filePath, "zip", "page01.jpg")
+	releaseBuffer(MaxBufferedTotal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if _, ok := rc.(io.Seeker); ok {
+		t.Error("expected the entry to be streamed once the buffering limit is reached")
+	}
+
+	rc, err = open(filePath, "zip", "page01.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rc.(io.Seeker); !ok {
+		t.Error("expected the entry to be loaded in memory")
+	}
+	rc.Close()
+	rc.Close()
+	if buffered.size != 0 {
+		t.Errorf("expected the buffers to be released, got %d bytes", buffered.size)
+	}
+}
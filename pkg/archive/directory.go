@@ -0,0 +1,218 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/dlna"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/h2non/filetype"
+)
+
+// Config configures the archive browsing
+type Config struct {
+	// Enabled exposes the ZIP, CBZ and TAR archives as containers
+	Enabled bool `json:"enabled"`
+}
+
+// Directory exposes the archives of a ContentDirectory as containers, listing their entries.
+// The entries are identified by their path in the archive, appended to the identifier of the archive.
+// The archives that cannot be read are left as items.
+// It implements cds.ContentOpener, so the FileServer can stream the entries.
+type Directory struct {
+	cds.ContentDirectory
+	// Lister caches the listings of the archives, it can be shared by several Directories
+	Lister *Lister
+}
+
+func (d *Directory) Get(id filesystem.ID, ctx context.Context) (*cds.Object, error) {
+	if arc, name, ok := d.split(id, ctx); ok {
+		l, err := d.Lister.list(arc, ctx)
+		if err != nil {
+			return nil, err
+		}
+		e, found := l.entries[name]
+		if !found {
+			return nil, os.ErrNotExist
+		}
+		return newEntryObject(arc, e, l), nil
+	}
+	obj, err := d.ContentDirectory.Get(id, ctx)
+	if err != nil || !isArchive(obj) {
+		return obj, err
+	}
+	l, err := d.Lister.list(obj, ctx)
+	if err != nil {
+		return obj, nil
+	}
+
+	// Do not alter the object of the underlying ContentDirectory, which could be cached
+	ctn := *obj
+	ctn.IsDir = true
+	ctn.Size = 0
+	ctn.Title = trimFormat(obj.Name)
+	ctn.MimeType = cds.FolderType
+	ctn.Resources = nil
+	ctn.ChildrenID = childrenID(id, "", l)
+	return &ctn, nil
+}
+
+func (d *Directory) GetChildren(id filesystem.ID, ctx context.Context) ([]*cds.Object, error) {
+	arc, name, ok := d.split(id, ctx)
+	if !ok {
+		obj, err := d.ContentDirectory.Get(id, ctx)
+		if err != nil || !isArchive(obj) {
+			return d.getChildren(id, ctx)
+		}
+		arc = obj
+	}
+	l, err := d.Lister.list(arc, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if e, found := l.entries[name]; name != "" && (!found || !e.isDir) {
+		return nil, os.ErrNotExist
+	}
+	// Avoid reading the archive for each entry
+	children := make([]*cds.Object, len(l.children[name]))
+	for i, childName := range l.children[name] {
+		children[i] = newEntryObject(arc, l.entries[childName], l)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].IsDir != children[j].IsDir {
+			return children[i].IsDir
+		}
+		return children[i].Name < children[j].Name
+	})
+	return children, ctx.Err()
+}
+
+// getChildren lists the children of a regular container, replacing the archives by their containers
+func (d *Directory) getChildren(id filesystem.ID, ctx context.Context) ([]*cds.Object, error) {
+	children, err := d.ContentDirectory.GetChildren(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, child := range children {
+		if isArchive(child) {
+			if ctn, err := d.Get(child.ID, ctx); err == nil {
+				children[i] = ctn
+			}
+		}
+	}
+	return children, nil
+}
+
+// split looks for the archive containing the entry identified by id.
+// It returns the archive and the name of the entry, or false if id is not an archive entry.
+func (d *Directory) split(id filesystem.ID, ctx context.Context) (*cds.Object, string, bool) {
+	for p := id.ParentID(); !p.IsRoot() && !p.IsNull(); p = p.ParentID() {
+		if Format(p.BaseName()) == "" {
+			continue
+		}
+		if arc, err := d.ContentDirectory.Get(p, ctx); err == nil && isArchive(arc) {
+			return arc, strings.TrimPrefix(id.String(), p.String()+"/"), true
+		}
+	}
+	return nil, "", false
+}
+
+// isArchive returns true if obj is an archive file of the underlying ContentDirectory
+func isArchive(obj *cds.Object) bool {
+	return !obj.IsContainer() && Format(obj.Name) != ""
+}
+
+// CanOpen implements cds.ContentOpener
+func (d *Directory) CanOpen(obj *cds.Object) bool {
+	_, ok := d.entryName(obj)
+	return ok
+}
+
+// Open implements cds.ContentOpener.
+// The reader can seek if the entry is stored uncompressed, or if it is small enough to be loaded in memory,
+// see MaxBufferedSize and MaxBufferedTotal.
+func (d *Directory) Open(obj *cds.Object) (io.ReadCloser, error) {
+	name, ok := d.entryName(obj)
+	if !ok {
+		return nil, os.ErrInvalid
+	}
+	return open(obj.FilePath, Format(obj.FilePath), name)
+}
+
+// entryName returns the name of an archive entry, looking for the archive identified by a prefix of its identifier.
+// Matching the names is not enough, as the archive could contain a directory with the same name.
+func (d *Directory) entryName(obj *cds.Object) (string, bool) {
+	if obj.IsContainer() || Format(obj.FilePath) == "" {
+		return "", false
+	}
+	arc, name, ok := d.split(obj.ID, context.Background())
+	if !ok || arc.FilePath != obj.FilePath {
+		return "", false
+	}
+	return name, true
+}
+
+// childrenID returns the identifiers of the children of the directory name of an archive
+func childrenID(arcID filesystem.ID, name string, l *listing) []filesystem.ID {
+	ids := make([]filesystem.ID, len(l.children[name]))
+	for i, childName := range l.children[name] {
+		ids[i] = arcID.ChildID(childName)
+	}
+	return ids
+}
+
+// newEntryObject creates the object of an entry of the archive arc
+func newEntryObject(arc *cds.Object, e *entry, l *listing) *cds.Object {
+	id := arc.ID.ChildID(e.name)
+	name := path.Base(e.name)
+	obj := &cds.Object{
+		Object: filesystem.Object{
+			ID: id,
+			// The items are fresh as long as their archive is
+			FileItem: arc.FileItem,
+			Name:     name,
+			IsDir:    e.isDir,
+		},
+		Title: name,
+	}
+	if e.isDir {
+		obj.MimeType = cds.FolderType
+		obj.ChildrenID = childrenID(arc.ID, e.name, l)
+		return obj
+	}
+
+	obj.Size = e.size
+	ext := path.Ext(name)
+	obj.MimeType = filetype.GetType(strings.TrimPrefix(strings.ToLower(ext), ".")).MIME
+	obj.Title = strings.TrimSuffix(name, ext)
+
+	res := cds.Resource{
+		URL:          cds.FileServerURLSpec(id),
+		Size:         uint64(e.size),
+		ProtocolInfo: cds.ProtocolInfo{MimeType: obj.MimeType},
+	}
+	if e.seekable {
+		res.ProtocolInfo.Set(cds.DLNAOperation, dlna.OpByteSeek)
+	}
+	res.ProtocolInfo.Set(cds.DLNAConversion, dlna.NotConverted)
+	if obj.MimeType.Type == "image" {
+		res.ProtocolInfo.Set(cds.DLNAFlags, dlna.InteractiveFlags.String())
+	} else {
+		res.ProtocolInfo.Set(cds.DLNAFlags, dlna.StreamingFlags.String())
+	}
+	obj.AddResource(res)
+	return obj
+}
+
+// trimFormat removes the archive extension of a name
+func trimFormat(name string) string {
+	if strings.HasSuffix(strings.ToLower(name), ".tar.gz") {
+		return name[:len(name)-len(".tar.gz")]
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The archive contains a directory with its own name
+	filePath := filepath.Join(dir, "a.zip")
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"a.zip/x.jpg", "x.jpg"} {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = io.WriteString(w, name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fs, err := filesystem.New(filesystem.Config{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lister := NewLister(&cache.Manager{L: logging.NewTesting(t)})
+	d := &Directory{ContentDirectory: &cds.FilesystemContentDirectory{FS: fs}, Lister: lister}
+	ctx := context.Background()
+
+	obj, err := d.Get(filesystem.ID("/a.zip/a.zip/x.jpg"), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.CanOpen(obj) {
+		t.Fatalf("expected %q to be opened by the directory", obj.ID)
+	}
+	rc, err := d.Open(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(content) != "a.zip/x.jpg" {
+		t.Errorf("Open(%q), expected %q, got %q (%v)", obj.ID, "a.zip/x.jpg", content, err)
+	}
+
+	arc, err := d.ContentDirectory.Get(filesystem.ID("/a.zip"), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1, err1 := lister.list(arc, ctx)
+	l2, err2 := lister.list(arc, ctx)
+	if err1 != nil || err2 != nil || l1 != l2 {
+		t.Errorf("expected the listing to be read once, got %p, %p (%v, %v)", l1, l2, err1, err2)
+	}
+	modified := *arc
+	modified.ModTime = arc.ModTime.Add(time.Second)
+	if l3, err := lister.list(&modified, ctx); err != nil || l3 == l1 {
+		t.Errorf("expected the listing to be read again after a modification, got %p (%v)", l3, err)
+	}
+}
@@ -0,0 +1,48 @@
+package archive
+
+import (
+	"context"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+)
+
+// Lister caches the listings of the archives in memory, so they are read once as long as they are not modified.
+// The methods of a nil Lister read the archives each time.
+type Lister struct {
+	m cache.Memo
+}
+
+// listingKey identifies a version of an archive
+type listingKey struct {
+	filePath string
+	modTime  int64
+}
+
+func NewLister(cm *cache.Manager) *Lister {
+	l := &Lister{}
+	l.m = cm.NewMemoryMemo("archives", l.loader)
+	return l
+}
+
+// list returns the listing of the archive arc
+func (l *Lister) list(arc *cds.Object, ctx context.Context) (*listing, error) {
+	if l == nil {
+		return list(arc.FilePath, Format(arc.FilePath))
+	}
+	select {
+	case res := <-l.m.Get(listingKey{arc.FilePath, arc.ModTime.UnixNano()}):
+		value, err := res.Value()
+		if err != nil {
+			return nil, err
+		}
+		return value.(*listing), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *Lister) loader(key interface{}) (interface{}, error) {
+	k := key.(listingKey)
+	return list(k.filePath, Format(k.filePath))
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// ErrNotSupported is returned by the operations that the backend does not implement
+var ErrNotSupported = errors.New("not supported by the cache backend")
+
+// Backend stores raw entries in named buckets
+type Backend interface {
+	// Bucket returns the bucket named name, creating it if need be
+	Bucket(name string) (Bucket, error)
+	// String returns the location of the backend, for reports
+	String() string
+	Close() error
+}
+
+// Bucket is a set of raw entries. The slices returned by Get are owned by the caller.
+type Bucket interface {
+	// Get returns the value of the entry, or nil if it does not exist
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// ForEach calls fn for each entry, until it returns an error.
+	// fn must not modify the bucket, nor keep the slices after returning.
+	ForEach(fn func(key, value []byte) error) error
+	// Clear removes all the entries
+	Clear() error
+}
+
+// DBStatsReporter is implemented by the backends that can describe all their buckets, including those not managed by the Manager
+type DBStatsReporter interface {
+	DBStats() (DBStats, error)
+}
+
+// Compacter is implemented by the backends that can reclaim their unused space while in use
+type Compacter interface {
+	Compact() error
+}
+
+// Driver opens the backend designated by an URL
+type Driver func(u *url.URL) (Backend, error)
+
+var (
+	drivers   = make(map[string]Driver)
+	driversMu sync.Mutex
+)
+
+// RegisterDriver makes a driver available for the URLs with the given scheme
+func RegisterDriver(scheme string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[scheme] = d
+}
+
+// Drivers returns the schemes of the registered drivers
+func Drivers() (schemes []string) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	for scheme := range drivers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return
+}
+
+// Open opens the backend designated by rawurl, e.g. "bolt:///var/cache/dms.db" or "redis://localhost/0".
+// Paths without scheme are opened as bolt databases.
+func Open(rawurl string) (Backend, error) {
+	u, err := parseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	driversMu.Lock()
+	d, found := drivers[u.Scheme]
+	driversMu.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unknown cache driver %q, available drivers: %v", u.Scheme, Drivers())
+	}
+	return d(u)
+}
+
+func parseURL(rawurl string) (*url.URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || len(u.Scheme) <= 1 {
+		// A bare path, maybe with a drive letter on Windows
+		return &url.URL{Scheme: "bolt", Path: rawurl}, nil
+	}
+	return u, nil
+}
+
+// urlPath returns the path of the file designated by u, accepting both "scheme:///abs/path" and "scheme:rel/path"
+func urlPath(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Host + u.Path
+}
+
+func init() {
+	RegisterDriver("mem", openMemBackend)
+}
+
+var (
+	memBackends   = make(map[string]*memBackend)
+	memBackendsMu sync.Mutex
+)
+
+// memBackend is an in-memory stand-in for the shared backends.
+// The URLs with the same host, e.g. "mem://test", open the same backend, which lives as long as the process.
+type memBackend struct {
+	name    string
+	buckets map[string]*memBucket
+	mu      sync.Mutex
+}
+
+func openMemBackend(u *url.URL) (Backend, error) {
+	memBackendsMu.Lock()
+	defer memBackendsMu.Unlock()
+	b := memBackends[u.Host]
+	if b == nil {
+		b = &memBackend{name: u.Host, buckets: make(map[string]*memBucket)}
+		memBackends[u.Host] = b
+	}
+	return b, nil
+}
+
+func (b *memBackend) Bucket(name string) (Bucket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bk := b.buckets[name]
+	if bk == nil {
+		bk = &memBucket{entries: make(map[string][]byte)}
+		b.buckets[name] = bk
+	}
+	return bk, nil
+}
+
+func (b *memBackend) String() string {
+	return "mem://" + b.name
+}
+
+func (b *memBackend) Close() error {
+	return nil
+}
+
+type memBucket struct {
+	entries map[string][]byte
+	mu      sync.RWMutex
+}
+
+func (b *memBucket) Get(key []byte) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if value, found := b.entries[string(key)]; found {
+		return append([]byte(nil), value...), nil
+	}
+	return nil, nil
+}
+
+func (b *memBucket) Put(key, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (b *memBucket) Delete(key []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, string(key))
+	return nil
+}
+
+func (b *memBucket) ForEach(fn func(key, value []byte) error) error {
+	b.mu.RLock()
+	keys := make([][]byte, 0, len(b.entries))
+	for key := range b.entries {
+		keys = append(keys, []byte(key))
+	}
+	b.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	for _, key := range keys {
+		value, err := b.Get(key)
+		if err == nil && value != nil {
+			err = fn(key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memBucket) Clear() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = make(map[string][]byte)
+	return nil
+}
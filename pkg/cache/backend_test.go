@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestBackends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dms-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	urls := []string{"mem://backends", filepath.Join(dir, "bare.db"), "bolt://" + filepath.Join(dir, "cache.db")}
+	if _, found := drivers["sqlite"]; found {
+		urls = append(urls, "sqlite://"+filepath.Join(dir, "cache.sqlite"))
+	}
+	// e.g. DMS_TEST_REDIS=redis://localhost/15
+	if u := os.Getenv("DMS_TEST_REDIS"); u != "" {
+		urls = append(urls, u+"?prefix=dms-test:")
+	}
+
+	for _, u := range urls {
+		b, err := Open(u)
+		if err != nil {
+			t.Errorf("%s: %s", u, err)
+			continue
+		}
+		testBackend(t, u, b)
+		b.Close()
+	}
+}
+
+func testBackend(t *testing.T, u string, b Backend) {
+	bk, err := b.Bucket("test")
+	if err == nil {
+		err = bk.Clear()
+	}
+	for _, k := range []string{"b", "a", "c"} {
+		if err == nil {
+			err = bk.Put([]byte(k), []byte("value of "+k))
+		}
+	}
+	if err == nil {
+		err = bk.Delete([]byte("c"))
+	}
+	if err != nil {
+		t.Errorf("%s: %s", u, err)
+		return
+	}
+
+	if value, err := bk.Get([]byte("a")); err != nil || string(value) != "value of a" {
+		t.Errorf("%s: Get(a), got %q, %v", u, value, err)
+	}
+	if value, err := bk.Get([]byte("c")); err != nil || value != nil {
+		t.Errorf("%s: Get(c), expected nothing, got %q, %v", u, value, err)
+	}
+	found := make(map[string]string)
+	err = bk.ForEach(func(k, v []byte) error {
+		found[string(k)] = string(v)
+		return nil
+	})
+	if err != nil || len(found) != 2 || found["b"] != "value of b" {
+		t.Errorf("%s: ForEach, got %v, %v", u, found, err)
+	}
+}
+
+func TestSharedBackend(t *testing.T) {
+	l := logging.NewTesting(t)
+	defer dropMemBackend("shared")
+	var managers [2]*Manager
+	for i := range managers {
+		b, err := Open("mem://shared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		managers[i] = &Manager{Backend: b, L: l}
+	}
+
+	calls := 0
+	loader := func(key interface{}) (interface{}, error) {
+		calls++
+		return &testEntry{Fresh: true, Name: key.(string)}, nil
+	}
+	for _, m := range managers {
+		value, err := (<-m.NewMemo("shared", testEntry{}, loader).Get("key")).Value()
+		if err != nil || value.(*testEntry).Name != "key" {
+			t.Errorf("unexpected result: %v, %v", value, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the second memo to use the shared entry, got %d calls", calls)
+	}
+}
+
+// dropMemBackend forgets an in-memory backend, so the next run of the test starts afresh
+func dropMemBackend(name string) {
+	memBackendsMu.Lock()
+	defer memBackendsMu.Unlock()
+	delete(memBackends, name)
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	if _, err := Open("unknown://host"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"net/url"
+	"os"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func init() {
+	RegisterDriver("bolt", openBoltBackend)
+}
+
+// BoltBackend stores the buckets in a bolt database, which can be shared with other components
+type BoltBackend struct {
+	DB *bolt.DB
+}
+
+func openBoltBackend(u *url.URL) (Backend, error) {
+	// Fail instead of waiting for another instance to release the database
+	db, err := bolt.Open(urlPath(u), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltBackend{db}, nil
+}
+
+func (b *BoltBackend) Bucket(name string) (Bucket, error) {
+	bk := &boltBucket{b.DB, []byte(name)}
+	err := b.DB.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bk.name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bk, nil
+}
+
+func (b *BoltBackend) String() string {
+	return b.DB.Path()
+}
+
+func (b *BoltBackend) Flush() {
+	b.DB.Sync()
+}
+
+func (b *BoltBackend) Close() error {
+	b.DB.Sync()
+	return b.DB.Close()
+}
+
+// DBStats returns the statistics of all the buckets of the database
+func (b *BoltBackend) DBStats() (st DBStats, err error) {
+	st.Path = b.DB.Path()
+	dbst := b.DB.Stats()
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		st.Size = tx.Size()
+		st.Free = int64(dbst.FreePageN+dbst.PendingPageN) * int64(tx.DB().Info().PageSize)
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			bst := BucketStats{Name: string(name)}
+			countBucket(b, &bst)
+			st.Buckets = append(st.Buckets, bst)
+			return nil
+		})
+	})
+	return
+}
+
+func countBucket(b *bolt.Bucket, st *BucketStats) {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		st.Bytes += int64(len(k) + len(v))
+		if v == nil {
+			countBucket(b.Bucket(k), st)
+		} else {
+			st.Entries++
+		}
+	}
+}
+
+type boltBucket struct {
+	db   *bolt.DB
+	name []byte
+}
+
+func (b *boltBucket) Get(key []byte) (value []byte, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(b.name).Get(key); v != nil {
+			// v is only valid during the transaction
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return
+}
+
+func (b *boltBucket) Put(key, value []byte) error {
+	return b.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.name).Put(key, value)
+	})
+}
+
+func (b *boltBucket) Delete(key []byte) error {
+	return b.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.name).Delete(key)
+	})
+}
+
+func (b *boltBucket) ForEach(fn func(key, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.name).ForEach(fn)
+	})
+}
+
+func (b *boltBucket) Clear() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(b.name); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(b.name)
+		return err
+	})
+}
+
+// compactBolt rewrites the database at path, without its free pages
+func compactBolt(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	src, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".compact"
+	dst, err := bolt.Open(tmpPath, fi.Mode(), &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	err = src.View(func(stx *bolt.Tx) error {
+		return stx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return dst.Update(func(dtx *bolt.Tx) error {
+				db, err := dtx.CreateBucket(name)
+				if err == nil {
+					err = copyBucket(b, db)
+				}
+				return err
+			})
+		})
+	})
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		src.Close()
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+func copyBucket(src, dst *bolt.Bucket) error {
+	// The keys are inserted in order, so the pages can be filled up
+	dst.FillPercent = 1.0
+	c := src.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			if err := dst.Put(k, v); err != nil {
+				return err
+			}
+			continue
+		}
+		sub, err := dst.CreateBucket(k)
+		if err == nil {
+			err = copyBucket(src.Bucket(k), sub)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Adirelle/go-libs/logging"
+	"github.com/gorilla/mux"
+)
+
+const (
+	MaintenanceRoute        = "cache-maintenance"
+	RouteOperationParameter = "operation"
+	RouteOperationTemplate  = "{" + RouteOperationParameter + ":stats|verify|purge}"
+	statsOperation          = "stats"
+	verifyOperation         = "verify"
+	purgeOperation          = "purge"
+)
+
+// Handler serves the statistics of the caches, and verifies or purges the database.
+// Purging requires a POST request.
+type Handler struct {
+	m     *Manager
+	valid Validator
+	l     logging.Logger
+}
+
+func NewHandler(m *Manager, valid Validator, l logging.Logger) *Handler {
+	return &Handler{m, valid, l}
+}
+
+// StatsReport is the response of the stats operation
+type StatsReport struct {
+	Database *DBStats         `json:"database,omitempty"`
+	Memory   map[string]Stats `json:"memory"`
+}
+
+// Stats returns the statistics of both the database, if any, and the in-memory storages
+func (h *Handler) Stats() (r StatsReport, err error) {
+	r.Memory = h.m.Stats()
+	if h.m.Backend != nil {
+		var st DBStats
+		if st, err = h.m.DBStats(); err == nil {
+			r.Database = &st
+		}
+	}
+	return
+}
+
+// Verify checks the entries of the database
+func (h *Handler) Verify() ([]CheckReport, error) {
+	return h.m.Verify(h.valid)
+}
+
+// Purge removes the invalid entries of the database
+func (h *Handler) Purge() ([]CheckReport, error) {
+	return h.m.Purge(h.valid)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		data interface{}
+		err  error
+	)
+	switch op := mux.Vars(r)[RouteOperationParameter]; op {
+	case statsOperation:
+		data, err = h.Stats()
+	case verifyOperation:
+		data, err = h.Verify()
+	case purgeOperation:
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "purging requires a POST request", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err = h.Purge()
+	default:
+		http.Error(w, "unknown operation: "+op, http.StatusNotFound)
+		return
+	}
+	if err == ErrNoDB {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.FromContext(r.Context(), h.l).Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		logging.FromContext(r.Context(), h.l).Warn(err)
+	}
+}
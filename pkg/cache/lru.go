@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Limit bounds an in-memory storage. The zero values mean no limit.
+type Limit struct {
+	// Entries is the maximum number of entries
+	Entries int `json:"entries"`
+	// Bytes is the maximum memory used by the entries, as estimated by EstimateSize
+	Bytes int64 `json:"bytes"`
+}
+
+// Stats reports the usage of an in-memory storage. Bytes is only estimated when the storage has a Bytes limit.
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// StatsReporter is implemented by the storages that keep usage statistics
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// lruStorage is an in-memory storage that evicts the least recently used entries to stay within its limit
+type lruStorage struct {
+	limit   Limit
+	entries map[interface{}]*list.Element
+	order   *list.List
+	stats   Stats
+	mu      sync.Mutex
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+	size  int64
+}
+
+func NewLRUStorage(limit Limit) Storage {
+	return &lruStorage{
+		limit:   limit,
+		entries: make(map[interface{}]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (s *lruStorage) Store(key, value interface{}) {
+	// Estimating the size walks the whole value, only do it if needed
+	var size int64
+	if s.limit.Bytes > 0 {
+		size = EstimateSize(key) + EstimateSize(value)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, found := s.entries[key]; found {
+		e := el.Value.(*lruEntry)
+		s.stats.Bytes += size - e.size
+		e.value, e.size = value, size
+		s.order.MoveToFront(el)
+	} else {
+		s.entries[key] = s.order.PushFront(&lruEntry{key, value, size})
+		s.stats.Bytes += size
+	}
+	s.evict()
+}
+
+func (s *lruStorage) Fetch(key interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, found := s.entries[key]
+	if !found {
+		s.stats.Misses++
+		return nil
+	}
+	s.stats.Hits++
+	s.order.MoveToFront(el)
+	return el.Value.(*lruEntry).value
+}
+
+func (s *lruStorage) Delete(key interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, found := s.entries[key]; found {
+		s.remove(el)
+	}
+}
+
+func (s *lruStorage) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Entries = len(s.entries)
+	return st
+}
+
+// evict removes the least recently used entries until the storage is within its limit.
+// The most recent entry is always kept.
+func (s *lruStorage) evict() {
+	for s.order.Len() > 1 && s.overLimit() {
+		s.remove(s.order.Back())
+		s.stats.Evictions++
+	}
+}
+
+func (s *lruStorage) overLimit() bool {
+	return (s.limit.Entries > 0 && s.order.Len() > s.limit.Entries) ||
+		(s.limit.Bytes > 0 && s.stats.Bytes > s.limit.Bytes)
+}
+
+func (s *lruStorage) remove(el *list.Element) {
+	e := s.order.Remove(el).(*lruEntry)
+	delete(s.entries, e.key)
+	s.stats.Bytes -= e.size
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLRUStorage(t *testing.T) {
+	s := NewLRUStorage(Limit{Entries: 2})
+	s.Store("a", 1)
+	s.Store("b", 2)
+	s.Fetch("a")
+	s.Store("c", 3)
+
+	for key, expected := range map[string]interface{}{"a": 1, "b": nil, "c": 3} {
+		if actual := s.Fetch(key); actual != expected {
+			t.Errorf("Fetch(%q), expected %v, got %v", key, expected, actual)
+		}
+	}
+	expected := Stats{Entries: 2, Hits: 3, Misses: 1, Evictions: 1}
+	actual := s.(StatsReporter).Stats()
+	actual.Bytes = 0
+	if actual != expected {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestLRUStorageBytes(t *testing.T) {
+	value := make([]byte, 100)
+	s := NewLRUStorage(Limit{Bytes: 3 * EstimateSize(value)})
+	for _, key := range []string{"a", "b", "c", "d"} {
+		s.Store(key, make([]byte, 100))
+	}
+	if st := s.(StatsReporter).Stats(); st.Entries != 2 || st.Evictions != 2 {
+		t.Errorf("expected 2 entries and 2 evictions, got %+v", st)
+	}
+}
+
+func TestEstimateSizeTime(t *testing.T) {
+	local := time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local)
+	if actual, expected := EstimateSize(local), int64(reflect.TypeOf(local).Size()); actual != expected {
+		t.Errorf("expected %d bytes, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	// ErrNoDB is returned by the maintenance operations when there is no cache database
+	ErrNoDB = errors.New("no cache database")
+	// ErrReadOnly is returned by Purge when the Manager is read-only
+	ErrReadOnly = errors.New("read-only cache database")
+)
+
+// Validator returns false for the cached values that should be discarded, e.g. because they refer to files outside of the served directories
+type Validator func(value interface{}) bool
+
+// DBStats describes the content of the cache database
+type DBStats struct {
+	// Path is the location of the database, a file path or an URL
+	Path string `json:"path"`
+	// Size is the size of the database
+	Size int64 `json:"size"`
+	// Free is the unused space that compacting would reclaim, if known
+	Free    int64         `json:"free"`
+	Buckets []BucketStats `json:"buckets"`
+}
+
+// BucketStats describes the content of a bucket
+type BucketStats struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	// Bytes is the total size of the keys and the values
+	Bytes int64 `json:"bytes"`
+}
+
+// CheckReport lists the invalid entries of a bucket, found by Verify or removed by Purge
+type CheckReport struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	// Stale is the number of entries that are not fresh, or are rejected by the Validator
+	Stale int `json:"stale"`
+	// Corrupted is the number of entries that cannot be decoded
+	Corrupted int `json:"corrupted"`
+	// Outdated is the number of entries stored with a previous schema, which are migrated or dropped when
+	// the bucket is opened by a Manager that is not read-only. They are not checked.
+	Outdated int `json:"outdated"`
+}
+
+// Invalid returns the number of invalid entries
+func (r CheckReport) Invalid() int {
+	return r.Stale + r.Corrupted
+}
+
+// DBStats returns the statistics of the database.
+// They include all its buckets if the backend is a DBStatsReporter, else only the managed ones.
+func (m *Manager) DBStats() (st DBStats, err error) {
+	if m.Backend == nil {
+		return st, ErrNoDB
+	}
+	if r, ok := m.Backend.(DBStatsReporter); ok {
+		return r.DBStats()
+	}
+	st.Path = m.Backend.String()
+	for _, name := range m.bucketNames() {
+		bst := BucketStats{Name: name}
+		err = m.buckets[name].bucket.ForEach(func(k, v []byte) error {
+			bst.Entries++
+			bst.Bytes += int64(len(k) + len(v))
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		st.Size += bst.Bytes
+		st.Buckets = append(st.Buckets, bst)
+	}
+	return
+}
+
+// Verify checks the entries of the managed buckets, without altering them.
+// The buckets are altered when they are opened, unless the Manager is read-only.
+func (m *Manager) Verify(valid Validator) ([]CheckReport, error) {
+	return m.check(valid, false)
+}
+
+// Purge removes the invalid entries of the managed buckets.
+// The in-memory storages are left untouched, as their entries are checked on access.
+func (m *Manager) Purge(valid Validator) ([]CheckReport, error) {
+	return m.check(valid, true)
+}
+
+func (m *Manager) check(valid Validator, purge bool) (reports []CheckReport, err error) {
+	if m.Backend == nil {
+		return nil, ErrNoDB
+	}
+	if purge && m.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	for _, name := range m.bucketNames() {
+		s := m.buckets[name]
+		r, invalid, err := s.check(valid)
+		for i := 0; err == nil && purge && i < len(invalid); i++ {
+			err = s.bucket.Delete(invalid[i])
+		}
+		if err != nil {
+			return reports, err
+		}
+		if purge {
+			m.L.Infof("%s: purged %d stale and %d corrupted entries out of %d", name, r.Stale, r.Corrupted, r.Entries)
+		}
+		reports = append(reports, r)
+	}
+	return
+}
+
+func (m *Manager) bucketNames() []string {
+	names := make([]string, 0, len(m.buckets))
+	for name := range m.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// check decodes all the entries and returns the keys of the invalid ones
+func (s *backendStorage) check(valid Validator) (r CheckReport, invalid [][]byte, err error) {
+	r.Name = s.name
+	err = s.bucket.ForEach(func(k, v []byte) error {
+		r.Entries++
+		if s.outdated {
+			r.Outdated++
+			return nil
+		}
+		value, err := s.decode(v)
+		switch {
+		case err != nil:
+			r.Corrupted++
+		case !isValid(value, valid):
+			r.Stale++
+		default:
+			return nil
+		}
+		invalid = append(invalid, append([]byte(nil), k...))
+		return nil
+	})
+	return
+}
+
+func isValid(value interface{}, valid Validator) bool {
+	if f, ok := value.(IsFresher); ok && !f.IsFresh() {
+		return false
+	}
+	return valid == nil || valid(value)
+}
+
+// Compact reclaims the unused space of the database designated by rawurl.
+// Bolt databases are rewritten, and must not be in use. The other backends must be Compacters.
+func Compact(rawurl string) error {
+	u, err := parseURL(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "bolt" {
+		return compactBolt(urlPath(u))
+	}
+	b, err := Open(rawurl)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	if c, ok := b.(Compacter); ok {
+		return c.Compact()
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Adirelle/go-libs/logging"
+	bolt "github.com/coreos/bbolt"
+)
+
+type testEntry struct {
+	Fresh bool
+	Name  string
+}
+
+func (e *testEntry) IsFresh() bool { return e.Fresh }
+
+func TestMaintenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dms-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{Backend: &BoltBackend{db}, L: logging.NewTesting(t)}
+	s := m.NewStorage("entries", testEntry{})
+	s.Store("fresh", &testEntry{Fresh: true})
+	s.Store("stale", &testEntry{})
+	s.Store("rejected", &testEntry{Fresh: true, Name: "rejected"})
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("entries")).Put([]byte("corrupted"), []byte("garbage"))
+	})
+
+	valid := func(value interface{}) bool { return value.(*testEntry).Name != "rejected" }
+	expected := CheckReport{Name: "entries", Entries: 4, Stale: 2, Corrupted: 1}
+	for _, op := range []func(Validator) ([]CheckReport, error){m.Verify, m.Purge} {
+		if r, err := op(valid); err != nil || len(r) != 1 || r[0] != expected {
+			t.Errorf("expected %+v, got %+v, %v", expected, r, err)
+		}
+	}
+
+	st, err := m.DBStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bst := range st.Buckets {
+		if bst.Name == "entries" && bst.Entries != 1 {
+			t.Errorf("expected 1 remaining entry, got %+v", bst)
+		}
+	}
+	db.Close()
+
+	if err := Compact(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err = bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if value := NewBoltDBStorage(db, "entries", testEntry{}, m.L).Fetch("fresh"); value == nil {
+		t.Error("expected the fresh entry to survive the compaction")
+	}
+}
+
+type otherEntry struct {
+	Other int
+}
+
+func TestReadOnlyMaintenance(t *testing.T) {
+	be, err := Open("mem://maintenance-read-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := logging.NewTesting(t)
+	m := &Manager{Backend: be, L: l}
+	m.NewStorage("entries", testEntry{}).Store("fresh", &testEntry{Fresh: true})
+	b, err := m.OpenBucket("raw", testEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Put([]byte("corrupted"), []byte("garbage"))
+
+	// The type of the entries changed
+	ro := &Manager{Backend: be, ReadOnly: true, L: l}
+	ro.NewStorage("entries", otherEntry{})
+	if _, err := ro.OpenBucket("raw", testEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []CheckReport{
+		{Name: "entries", Entries: 1, Outdated: 1},
+		{Name: "raw", Entries: 1, Corrupted: 1},
+	}
+	if r, err := ro.Verify(nil); err != nil || !reflect.DeepEqual(r, expected) {
+		t.Errorf("expected %+v, got %+v, %v", expected, r, err)
+	}
+	if _, err := ro.Purge(nil); err != ErrReadOnly {
+		t.Errorf("expected Purge to fail with %v, got %v", ErrReadOnly, err)
+	}
+
+	// The entries were left untouched
+	if _, err := m.Verify(nil); err != nil {
+		t.Fatal(err)
+	}
+	if value := m.buckets["entries"].Fetch("fresh"); value == nil {
+		t.Error("expected the outdated entry to be left untouched")
+	}
+}
@@ -1,40 +1,129 @@
 package cache
 
 import (
+	"reflect"
+	"time"
+
 	"github.com/Adirelle/go-libs/logging"
-	bolt "github.com/coreos/bbolt"
 )
 
 type Manager struct {
-	DB   *bolt.DB
+	// Backend persists the entries of the storages, nil to keep them in memory only
+	Backend Backend
+	// Size is the default maximum number of entries of the in-memory storages, 0 for no limit
 	Size int
-	L    logging.Logger
+	// Limits overrides the limits of the in-memory storages, by name
+	Limits map[string]Limit
+	// TTLs sets the time-to-live of the entries of the memos, by name. By default, they live as long as they are fresh.
+	TTLs map[string]time.Duration
+	// FailureTTL is the initial delay before retrying a failed load, DefaultFailureTTL if zero
+	FailureTTL time.Duration
+	// ReadOnly leaves the database untouched, e.g. to inspect it: the schemas of the buckets are not upgraded,
+	// and the storages keep their entries in memory only.
+	ReadOnly bool
+	L        logging.Logger
 
-	storages []Storage
+	storages map[string]Storage
+	buckets  map[string]*backendStorage
 }
 
 func (m *Manager) NewMemo(name string, sample interface{}, l LoaderFunc) Memo {
 	s := m.NewStorage(name, sample)
-	return &memo{s, l, NewSingleFlight(), m.L.Named(name)}
+	o := MemoOptions{TTL: m.TTLs[name], FailureTTL: m.FailureTTL}
+	return newMemo(s, l, o, m.L.Named(name))
+}
+
+// NewMemoryMemo creates a Memo which keeps its entries in memory only, e.g. for values that cannot be encoded.
+func (m *Manager) NewMemoryMemo(name string, l LoaderFunc) Memo {
+	s := NewLRUStorage(m.limit(name))
+	if m.storages == nil {
+		m.storages = make(map[string]Storage)
+	}
+	m.storages[name] = s
+	o := MemoOptions{TTL: m.TTLs[name], FailureTTL: m.FailureTTL}
+	return newMemo(s, l, o, m.L.Named(name))
+}
+
+func (m *Manager) NewStorage(name string, sample interface{}) (s Storage) {
+	mem := NewLRUStorage(m.limit(name))
+	if m.Backend == nil {
+		s = mem
+	} else {
+		dbs, err := m.openBucket(name, sample)
+		if err != nil {
+			panic(err)
+		}
+		if m.ReadOnly {
+			s = mem
+		} else {
+			s = &CombinedStorage{mem, dbs}
+		}
+	}
+	if m.storages == nil {
+		m.storages = make(map[string]Storage)
+	}
+	m.storages[name] = s
+	return
+}
+
+// OpenBucket opens a bucket of the backend holding values of the type of sample, see the OpenBucket function,
+// and includes it in the maintenance operations. It returns nil if there is no backend.
+func (m *Manager) OpenBucket(name string, sample interface{}) (Bucket, error) {
+	if m.Backend == nil {
+		return nil, nil
+	}
+	s, err := m.openBucket(name, sample)
+	if err != nil {
+		return nil, err
+	}
+	return s.bucket, nil
+}
+
+func (m *Manager) openBucket(name string, sample interface{}) (s *backendStorage, err error) {
+	l := m.L.Named(name)
+	s = &backendStorage{backend: m.Backend, name: name, t: reflect.TypeOf(sample), codec: GobCodec, l: l}
+	if m.ReadOnly {
+		s.bucket, s.outdated, err = inspectBucket(m.Backend, name, sample, l)
+	} else {
+		s.bucket, err = OpenBucket(m.Backend, name, sample, l)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.buckets == nil {
+		m.buckets = make(map[string]*backendStorage)
+	}
+	m.buckets[name] = s
+	return
+}
+
+func (m *Manager) limit(name string) Limit {
+	if l, found := m.Limits[name]; found {
+		return l
+	}
+	return Limit{Entries: m.Size}
 }
 
-func (m *Manager) NewStorage(name string, sample interface{}) Storage {
-	mem := NewMapStorage()
-	if m.DB == nil {
-		m.storages = append(m.storages, mem)
-		return mem
+// Stats returns the statistics of the in-memory storages, by name
+func (m *Manager) Stats() map[string]Stats {
+	stats := make(map[string]Stats, len(m.storages))
+	for name, s := range m.storages {
+		if r, ok := s.(StatsReporter); ok {
+			stats[name] = r.Stats()
+		}
 	}
-	dbs := NewBoltDBStorage(m.DB, name, sample, m.L.Named(name))
-	cbs := &CombinedStorage{mem, dbs}
-	m.storages = append(m.storages, cbs)
-	return cbs
+	return stats
 }
 
 func (m *Manager) Flush() {
 	m.L.Info("flushing")
-	for _, s := range m.storages {
+	for name, s := range m.storages {
 		if fl, ok := s.(Flusher); ok {
 			fl.Flush()
 		}
+		if r, ok := s.(StatsReporter); ok {
+			st := r.Stats()
+			m.L.Debugf("%s: %d entries, %d bytes, %d hits, %d misses, %d evictions", name, st.Entries, st.Bytes, st.Hits, st.Misses, st.Evictions)
+		}
 	}
 }
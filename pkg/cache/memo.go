@@ -1,9 +1,27 @@
 package cache
 
-import "github.com/Adirelle/go-libs/logging"
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+const (
+	// DefaultFailureTTL is the default delay before retrying a failed load
+	DefaultFailureTTL = 10 * time.Second
+	// DefaultMaxFailureTTL is the default maximum delay before retrying a load that keeps failing
+	DefaultMaxFailureTTL = 10 * time.Minute
+
+	// maxFailures is the number of failures above which the expired ones are pruned
+	maxFailures = 1024
+)
 
 type Memo interface {
-	Get(key interface{}) <-chan interface{}
+	// Get returns a channel receiving the result of the lookup, either a value or an error
+	Get(key interface{}) <-chan Result
+	Delete(key interface{})
 }
 
 type LoaderFunc func(interface{}) (interface{}, error)
@@ -12,30 +30,160 @@ type IsFresher interface {
 	IsFresh() bool
 }
 
+// MemoOptions configures the expiration of the entries of a Memo
+type MemoOptions struct {
+	// TTL is the time-to-live of the entries, 0 to keep them as long as they are fresh
+	TTL time.Duration
+	// FailureTTL is the delay before retrying a failed load. It doubles on each consecutive failure, up to MaxFailureTTL.
+	FailureTTL    time.Duration
+	MaxFailureTTL time.Duration
+}
+
 type memo struct {
 	Storage
 	f LoaderFunc
 	*SingleFlight
 	logging.Logger
+	MemoOptions
+
+	// loaded holds the load times of the entries, if they have a TTL
+	loaded   map[interface{}]time.Time
+	failures map[interface{}]*failure
+	mu       sync.Mutex
+}
+
+// failure records the consecutive failures to load an entry
+type failure struct {
+	err     error
+	count   uint
+	retryAt time.Time
+}
+
+func newMemo(s Storage, f LoaderFunc, o MemoOptions, l logging.Logger) *memo {
+	if o.FailureTTL <= 0 {
+		o.FailureTTL = DefaultFailureTTL
+	}
+	if o.MaxFailureTTL < o.FailureTTL {
+		o.MaxFailureTTL = DefaultMaxFailureTTL
+	}
+	sf := NewSingleFlight()
+	sf.L = l
+	return &memo{
+		Storage:      s,
+		f:            f,
+		SingleFlight: sf,
+		Logger:       l,
+		MemoOptions:  o,
+		loaded:       make(map[interface{}]time.Time),
+		failures:     make(map[interface{}]*failure),
+	}
 }
 
-func (m *memo) Get(key interface{}) <-chan interface{} {
+func (m *memo) Get(key interface{}) <-chan Result {
 	return m.Do(key, m.load)
 }
 
-func (m *memo) load(key interface{}) (interface{}, bool) {
+// Delete removes the entry, and forgets its failures
+func (m *memo) Delete(key interface{}) {
+	m.mu.Lock()
+	delete(m.loaded, key)
+	delete(m.failures, key)
+	m.mu.Unlock()
+	m.Storage.Delete(key)
+}
+
+func (m *memo) load(key interface{}) Result {
+	if err := m.failed(key); err != nil {
+		return NewResult(nil, err)
+	}
 	value := m.Fetch(key)
-	if value != nil {
-		if f, ok := value.(IsFresher); !ok || f.IsFresh() {
-			return value, true
-		}
+	if value != nil && m.isFresh(key, value) {
+		return NewResult(value, nil)
 	}
 	value, err := m.f(key)
+	if err == nil && value == nil {
+		err = ErrNoResult
+	}
 	if err != nil {
 		m.Warn(err)
-		m.Delete(key)
-		return nil, false
+		m.Storage.Delete(key)
+		m.fail(key, err)
+		return NewResult(nil, err)
 	}
 	m.Store(key, value)
-	return value, true
+	m.succeed(key)
+	return NewResult(value, nil)
+}
+
+func (m *memo) isFresh(key, value interface{}) bool {
+	if f, ok := value.(IsFresher); ok && !f.IsFresh() {
+		return false
+	}
+	if m.TTL <= 0 {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	loaded, found := m.loaded[key]
+	if !found {
+		// Loaded from a persistent storage, the TTL starts now
+		m.loaded[key] = time.Now()
+		return true
+	}
+	return time.Since(loaded) < m.TTL
+}
+
+// failed returns the error of the last load, if it should not be retried yet
+func (m *memo) failed(key interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, found := m.failures[key]; found && time.Now().Before(f.retryAt) {
+		return f.err
+	}
+	return nil
+}
+
+func (m *memo) fail(key interface{}, err error) {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		// Not an issue with the entry itself
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.loaded, key)
+	f, found := m.failures[key]
+	if !found {
+		if len(m.failures) >= maxFailures {
+			m.pruneFailures()
+		}
+		f = &failure{}
+		m.failures[key] = f
+	}
+	delay := m.FailureTTL << f.count
+	if delay > m.MaxFailureTTL || delay <= 0 {
+		delay = m.MaxFailureTTL
+	} else {
+		f.count++
+	}
+	f.err = err
+	f.retryAt = time.Now().Add(delay)
+}
+
+func (m *memo) succeed(key interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.failures, key)
+	if m.TTL > 0 {
+		m.loaded[key] = time.Now()
+	}
+}
+
+// pruneFailures forgets the failures that can be retried
+func (m *memo) pruneFailures() {
+	now := time.Now()
+	for key, f := range m.failures {
+		if now.After(f.retryAt) {
+			delete(m.failures, key)
+		}
+	}
 }
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestMemoFailures(t *testing.T) {
+	calls := 0
+	fail := errors.New("corrupted")
+	loader := func(interface{}) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, fail
+		}
+		return "value", nil
+	}
+	m := newMemo(NewLRUStorage(Limit{}), loader, MemoOptions{FailureTTL: time.Hour}, logging.NewTesting(t))
+
+	for i := 0; i < 2; i++ {
+		if value, err := (<-m.Get("key")).Value(); err != fail || value != nil {
+			t.Errorf("expected the load error, got %v, %v", value, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the failure to be cached, got %d calls", calls)
+	}
+
+	m.Delete("key")
+	if value, err := (<-m.Get("key")).Value(); err != nil || value != "value" {
+		t.Errorf("expected the value after deletion, got %v, %v", value, err)
+	}
+}
+
+func TestMemoTTL(t *testing.T) {
+	calls := 0
+	loader := func(interface{}) (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	m := newMemo(NewLRUStorage(Limit{}), loader, MemoOptions{TTL: time.Millisecond}, logging.NewTesting(t))
+	<-m.Get("key")
+	time.Sleep(2 * time.Millisecond)
+	if value, err := (<-m.Get("key")).Value(); err != nil || value != 2 {
+		t.Errorf("expected the entry to expire, got %v, %v", value, err)
+	}
+}
+
+func TestMemoPanic(t *testing.T) {
+	loader := func(interface{}) (interface{}, error) {
+		panic("boom")
+	}
+	m := newMemo(NewLRUStorage(Limit{}), loader, MemoOptions{}, logging.NewTesting(t))
+	if value, err := (<-m.Get("key")).Value(); err == nil || err.Error() != "boom" || value != nil {
+		t.Errorf("expected the panic as an error, got %v, %v", value, err)
+	}
+}
+
+func TestResult(t *testing.T) {
+	if _, err := (Result{}).Value(); err != ErrNoResult {
+		t.Errorf("expected the zero Result to hold ErrNoResult, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// DefaultRedisPrefix is the default prefix of the keys of the redis hashes
+	DefaultRedisPrefix = "dms:"
+	// RedisTimeout is the maximum delay to connect to the redis server
+	RedisTimeout = 5 * time.Second
+)
+
+func init() {
+	RegisterDriver("redis", openRedisBackend)
+}
+
+// redisBackend stores each bucket in a redis hash, so several instances can share their entries.
+// The URL accepts the options of redis.DialURL, and a "prefix" query parameter.
+type redisBackend struct {
+	pool   *redis.Pool
+	url    string
+	prefix string
+}
+
+func openRedisBackend(u *url.URL) (Backend, error) {
+	prefix := DefaultRedisPrefix
+	if p, found := u.Query()["prefix"]; found {
+		prefix = p[0]
+	}
+	dialURL := *u
+	dialURL.RawQuery = ""
+	rawurl := dialURL.String()
+	// Do not show the password in the reports
+	if dialURL.User != nil {
+		dialURL.User = url.User(dialURL.User.Username())
+	}
+	b := &redisBackend{
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.DialURL(rawurl, redis.DialConnectTimeout(RedisTimeout))
+			},
+			MaxIdle:     4,
+			IdleTimeout: time.Minute,
+		},
+		url:    dialURL.String(),
+		prefix: prefix,
+	}
+	// Check the connection early
+	if _, err := b.do("PING"); err != nil {
+		b.pool.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *redisBackend) do(cmd string, args ...interface{}) (interface{}, error) {
+	conn := b.pool.Get()
+	defer conn.Close()
+	return conn.Do(cmd, args...)
+}
+
+func (b *redisBackend) Bucket(name string) (Bucket, error) {
+	return &redisBucket{b, b.prefix + name}, nil
+}
+
+func (b *redisBackend) String() string {
+	return b.url
+}
+
+func (b *redisBackend) Close() error {
+	return b.pool.Close()
+}
+
+type redisBucket struct {
+	b   *redisBackend
+	key string
+}
+
+func (b *redisBucket) Get(key []byte) ([]byte, error) {
+	value, err := redis.Bytes(b.b.do("HGET", b.key, key))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (b *redisBucket) Put(key, value []byte) error {
+	_, err := b.b.do("HSET", b.key, key, value)
+	return err
+}
+
+func (b *redisBucket) Delete(key []byte) error {
+	_, err := b.b.do("HDEL", b.key, key)
+	return err
+}
+
+func (b *redisBucket) ForEach(fn func(key, value []byte) error) error {
+	cursor := 0
+	for {
+		values, err := redis.Values(b.b.do("HSCAN", b.key, cursor))
+		if err != nil {
+			return err
+		}
+		if cursor, err = redis.Int(values[0], nil); err != nil {
+			return err
+		}
+		fields, err := redis.ByteSlices(values[1], nil)
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if err := fn(fields[i], fields[i+1]); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (b *redisBucket) Clear() error {
+	_, err := b.b.do("DEL", b.key)
+	return err
+}
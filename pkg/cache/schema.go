@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+// SchemaBucket holds the schemas of the other buckets, by name
+const SchemaBucket = "cache-schemas"
+
+// Codec encodes the values stored in the database
+type Codec interface {
+	// Name identifies the encoding in the schemas
+	Name() string
+	Encode(w io.Writer, value interface{}) error
+	// Decode decodes data into the value pointed to by ptr
+	Decode(data []byte, ptr interface{}) error
+}
+
+// GobCodec encodes the values using encoding/gob
+var GobCodec Codec = gobCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Encode(w io.Writer, value interface{}) error {
+	return gob.NewEncoder(w).Encode(value)
+}
+
+func (gobCodec) Decode(data []byte, ptr interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(ptr)
+}
+
+// Schema describes how the entries of a bucket are encoded
+type Schema struct {
+	Codec string `json:"codec"`
+	// Version is the version declared by the stored type, see SchemaVersioner
+	Version int `json:"version"`
+	// Type is a fingerprint of the structure of the stored type
+	Type string `json:"type"`
+}
+
+// SchemaVersioner can be implemented by the cached types to declare their version, which defaults to 0.
+// Any change of the structure of a type drops the stored entries, unless its version is bumped and
+// migrations from the previous versions are registered.
+type SchemaVersioner interface {
+	SchemaVersion() int
+}
+
+// Migration converts an entry encoded with the previous version of a schema.
+// It returns nil data to drop the entry.
+type Migration func(data []byte) ([]byte, error)
+
+var (
+	migrations   = make(map[string]map[int]Migration)
+	migrationsMu sync.Mutex
+)
+
+// RegisterMigration registers the conversion of the entries of bucket from version-1 to version.
+// It must be called before the bucket is opened, e.g. in an init function.
+func RegisterMigration(bucket string, version int, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	if migrations[bucket] == nil {
+		migrations[bucket] = make(map[int]Migration)
+	}
+	migrations[bucket][version] = m
+}
+
+// migrationPath returns the migrations to apply to upgrade bucket from one version to another, or nil if there are none
+func migrationPath(bucket string, from, to int) (path []Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	for v := from + 1; v <= to; v++ {
+		m, found := migrations[bucket][v]
+		if !found {
+			return nil
+		}
+		path = append(path, m)
+	}
+	return
+}
+
+// NewSchema builds the schema of a bucket holding values of type t
+func NewSchema(c Codec, t reflect.Type) Schema {
+	s := Schema{Codec: c.Name(), Type: fingerprint(t)}
+	if v, ok := reflect.New(t).Interface().(SchemaVersioner); ok {
+		s.Version = v.SchemaVersion()
+	}
+	return s
+}
+
+var (
+	gobEncoderType    = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	binaryMarshalType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+)
+
+// fingerprint hashes the structure of t, as seen by encoding/gob
+func fingerprint(t reflect.Type) string {
+	h := crc32.NewIEEE()
+	describeType(h, t, make(map[reflect.Type]bool))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func describeType(w io.Writer, t reflect.Type, seen map[reflect.Type]bool) {
+	if seen[t] {
+		fmt.Fprint(w, t.String())
+		return
+	}
+	seen[t] = true
+	pt := reflect.PtrTo(t)
+	if pt.Implements(gobEncoderType) || pt.Implements(binaryMarshalType) {
+		// Encoded by the type itself
+		fmt.Fprint(w, t.String())
+		return
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		fmt.Fprint(w, t.Kind(), "[")
+		describeType(w, t.Elem(), seen)
+		fmt.Fprint(w, "]")
+	case reflect.Array:
+		fmt.Fprintf(w, "[%d]", t.Len())
+		describeType(w, t.Elem(), seen)
+	case reflect.Map:
+		fmt.Fprint(w, "map[")
+		describeType(w, t.Key(), seen)
+		fmt.Fprint(w, "]")
+		describeType(w, t.Elem(), seen)
+	case reflect.Struct:
+		fmt.Fprint(w, "struct{")
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.PkgPath == "" {
+				fmt.Fprint(w, f.Name, " ")
+				describeType(w, f.Type, seen)
+				fmt.Fprint(w, ";")
+			}
+		}
+		fmt.Fprint(w, "}")
+	default:
+		fmt.Fprint(w, t.Kind())
+	}
+}
+
+// OpenBucket opens the bucket named name of be, which holds values of the type of sample encoded with GobCodec.
+// The stored entries are migrated or dropped if the schema of the bucket changed, see SchemaVersioner.
+func OpenBucket(be Backend, name string, sample interface{}, l logging.Logger) (Bucket, error) {
+	b, err := be.Bucket(name)
+	if err == nil {
+		err = upgradeBucket(be, b, name, NewSchema(GobCodec, reflect.TypeOf(sample)), l)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// inspectBucket opens the bucket named name of be like OpenBucket, but leaves it untouched.
+// It returns true if the schema of the bucket changed, i.e. if OpenBucket would migrate or drop its entries.
+func inspectBucket(be Backend, name string, sample interface{}, l logging.Logger) (Bucket, bool, error) {
+	b, err := be.Bucket(name)
+	if err != nil {
+		return nil, false, err
+	}
+	s := NewSchema(GobCodec, reflect.TypeOf(sample))
+	stored, err := storedSchema(be, b, name, s, l)
+	if err != nil {
+		return nil, false, err
+	}
+	return b, stored != s, nil
+}
+
+// storedSchema returns the schema recorded for the bucket named name, or s if the bucket is new
+func storedSchema(be Backend, b Bucket, name string, s Schema, l logging.Logger) (stored Schema, err error) {
+	schemas, err := be.Bucket(SchemaBucket)
+	if err != nil {
+		return
+	}
+	data, err := schemas.Get([]byte(name))
+	if err != nil {
+		return
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			l.Warnf("invalid schema: %s", err)
+		}
+	} else if empty, err := isEmpty(b); err != nil {
+		return stored, err
+	} else if empty {
+		// New bucket
+		stored = s
+	}
+	return
+}
+
+// upgradeBucket checks the schema of the bucket named name.
+// If the schema changed, the entries are either migrated or dropped.
+func upgradeBucket(be Backend, b Bucket, name string, s Schema, l logging.Logger) error {
+	stored, err := storedSchema(be, b, name, s, l)
+	if err != nil {
+		return err
+	}
+
+	if stored != s {
+		var path []Migration
+		if stored.Codec == s.Codec && stored.Version < s.Version {
+			path = migrationPath(name, stored.Version, s.Version)
+		}
+		if path != nil {
+			l.Infof("migrating entries from version %d to %d", stored.Version, s.Version)
+			err = migrateBucket(b, path, l)
+		} else {
+			l.Infof("schema changed from %+v to %+v, dropping entries", stored, s)
+			err = b.Clear()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	schemas, err := be.Bucket(SchemaBucket)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return schemas.Put([]byte(name), data)
+}
+
+var errNotEmpty = errors.New("not empty")
+
+func isEmpty(b Bucket) (bool, error) {
+	err := b.ForEach(func(_, _ []byte) error { return errNotEmpty })
+	if err == errNotEmpty {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// migrateBucket applies the migrations to all the entries of the bucket, dropping those that fail
+func migrateBucket(b Bucket, path []Migration, l logging.Logger) error {
+	type entry struct{ key, data []byte }
+	var entries []entry
+	err := b.ForEach(func(k, v []byte) error {
+		data := v
+		var err error
+		for _, m := range path {
+			if data, err = m(data); err != nil || data == nil {
+				break
+			}
+		}
+		if err != nil {
+			l.Warnf("cannot migrate %q: %s", k, err)
+			data = nil
+		} else if data != nil {
+			// The slices passed by ForEach cannot be kept nor modified
+			data = append([]byte(nil), data...)
+		}
+		entries = append(entries, entry{append([]byte(nil), k...), data})
+		return nil
+	})
+	for _, e := range entries {
+		if err != nil {
+			break
+		}
+		if e.data == nil {
+			err = b.Delete(e.key)
+		} else {
+			err = b.Put(e.key, e.data)
+		}
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Adirelle/go-libs/logging"
+	bolt "github.com/coreos/bbolt"
+)
+
+type schemaV0 struct {
+	Name string
+}
+
+type schemaV1 struct {
+	Name  string
+	Title string
+}
+
+func (*schemaV1) SchemaVersion() int { return 1 }
+
+func init() {
+	RegisterMigration("migrated", 1, func(data []byte) ([]byte, error) {
+		var v0 schemaV0
+		if err := GobCodec.Decode(data, &v0); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err := GobCodec.Encode(&buf, &schemaV1{Name: v0.Name, Title: "migrated"})
+		return buf.Bytes(), err
+	})
+}
+
+func TestSchemaUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dms-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "cache.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	l := logging.NewTesting(t)
+
+	for _, bucket := range []string{"migrated", "dropped", "kept"} {
+		NewBoltDBStorage(db, bucket, schemaV0{}, l).Store("key", &schemaV0{Name: bucket})
+	}
+
+	if value := NewBoltDBStorage(db, "migrated", schemaV1{}, l).Fetch("key"); value == nil {
+		t.Error("expected the entry to be migrated")
+	} else if v1 := value.(*schemaV1); v1.Name != "migrated" || v1.Title != "migrated" {
+		t.Errorf("unexpected migrated entry: %+v", v1)
+	}
+	if value := NewBoltDBStorage(db, "dropped", schemaV1{}, l).Fetch("key"); value != nil {
+		t.Errorf("expected the entry to be dropped, got %+v", value)
+	}
+	if value := NewBoltDBStorage(db, "kept", schemaV0{}, l).Fetch("key"); value == nil {
+		t.Error("expected the entry to be kept")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	type recursive struct {
+		Name     string
+		Children []*recursive
+	}
+	for _, samples := range [][2]interface{}{
+		{schemaV0{}, schemaV1{}},
+		{schemaV0{}, recursive{}},
+		{struct{ A, B string }{}, struct{ A, C string }{}},
+		{struct{ A int }{}, struct{ A int64 }{}},
+	} {
+		if fingerprint(reflect.TypeOf(samples[0])) == fingerprint(reflect.TypeOf(samples[1])) {
+			t.Errorf("expected %T and %T to have different fingerprints", samples[0], samples[1])
+		}
+	}
+	if fingerprint(reflect.TypeOf(schemaV0{})) != fingerprint(reflect.TypeOf(struct{ Name string }{})) {
+		t.Error("expected identical structures to have the same fingerprint")
+	}
+}
@@ -1,10 +1,41 @@
 package cache
 
 import (
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
+
+	"github.com/Adirelle/go-libs/logging"
 )
 
+// ErrNoResult is returned when a loader yields neither a value nor an error
+var ErrNoResult = errors.New("no result")
+
+// Result holds either a value or an error. Its zero value holds ErrNoResult.
+type Result struct {
+	value interface{}
+	err   error
+}
+
+func NewResult(value interface{}, err error) Result {
+	if err != nil {
+		value = nil
+	}
+	return Result{value, err}
+}
+
+// Value returns the value or the error. The value is never nil when there is no error.
+func (r Result) Value() (interface{}, error) {
+	if r.err == nil && r.value == nil {
+		return nil, ErrNoResult
+	}
+	return r.value, r.err
+}
+
 type SingleFlight struct {
+	// L, if not nil, logs the panics of the called functions
+	L     logging.Logger
 	calls map[interface{}]*call
 	mu    sync.Mutex
 }
@@ -13,14 +44,15 @@ func NewSingleFlight() *SingleFlight {
 	return &SingleFlight{calls: make(map[interface{}]*call)}
 }
 
-func (f *SingleFlight) Do(key interface{}, fn func(interface{}) (interface{}, bool)) <-chan interface{} {
-	ch := make(chan interface{}, 1)
+// Do calls fn with key, unless a call with the same key is in progress, and sends its result to the returned channel.
+func (f *SingleFlight) Do(key interface{}, fn func(interface{}) Result) <-chan Result {
+	ch := make(chan Result, 1)
 	c := f.getOrStart(key, fn)
 	c.Listen(ch)
 	return ch
 }
 
-func (f *SingleFlight) getOrStart(key interface{}, fn func(interface{}) (interface{}, bool)) *call {
+func (f *SingleFlight) getOrStart(key interface{}, fn func(interface{}) Result) *call {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	c := f.calls[key]
@@ -29,7 +61,11 @@ func (f *SingleFlight) getOrStart(key interface{}, fn func(interface{}) (interfa
 		f.calls[key] = c
 		go func() {
 			defer f.done(key)
-			c.Run(func() (interface{}, bool) { return fn(key) })
+			c.Run(func() Result { return fn(key) }, func(e interface{}) {
+				if f.L != nil {
+					f.L.Errorf("panic while processing %v: %v\n%s", key, e, debug.Stack())
+				}
+			})
 		}()
 	}
 	return c
@@ -42,36 +78,42 @@ func (f *SingleFlight) done(key interface{}) {
 }
 
 type call struct {
-	chs []chan<- interface{}
-	mu  sync.Mutex
+	chs    []chan<- Result
+	result Result
+	done   bool
+	mu     sync.Mutex
 }
 
-func (c *call) Listen(ch chan<- interface{}) {
+func (c *call) Listen(ch chan<- Result) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.chs = append(c.chs, ch)
-}
-
-func (c *call) Run(fn func() (interface{}, bool)) {
-	defer c.close()
-	if value, ok := fn(); ok {
-		c.emit(value)
+	if c.done {
+		ch <- c.result
+		return
 	}
+	c.chs = append(c.chs, ch)
 }
 
-func (c *call) emit(value interface{}) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	for _, ch := range c.chs {
-		ch <- value
-	}
+// Run calls fn and emits its result. If fn panics, onPanic is called with the recovered value
+// and the listeners receive the panic as an error.
+func (c *call) Run(fn func() Result, onPanic func(interface{})) {
+	var r Result
+	defer func() {
+		if e := recover(); e != nil {
+			onPanic(e)
+			r = NewResult(nil, fmt.Errorf("%v", e))
+		}
+		c.emit(r)
+	}()
+	r = fn()
 }
 
-func (c *call) close() {
+func (c *call) emit(r Result) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.result, c.done = r, true
 	for _, ch := range c.chs {
-		close(ch)
+		ch <- r
 	}
 	c.chs = nil
 }
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// EstimateSize estimates the memory used by a value, including the memory it references.
+// Shared pointers are only counted once. time.Time values are counted for their own size,
+// the shared *time.Location they reference being ignored.
+func EstimateSize(v interface{}) int64 {
+	return sizeOf(reflect.ValueOf(v), make(map[uintptr]bool))
+}
+
+func sizeOf(v reflect.Value, seen map[uintptr]bool) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	return int64(v.Type().Size()) + referencedSize(v, seen)
+}
+
+// referencedSize returns the memory referenced by v, but not held in v itself
+func referencedSize(v reflect.Value, seen map[uintptr]bool) (size int64) {
+	if v.Type() == timeType {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return sizeOf(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return sizeOf(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size = int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			size += referencedSize(v.Field(i), seen)
+		}
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		for _, k := range v.MapKeys() {
+			size += sizeOf(k, seen) + sizeOf(v.MapIndex(k), seen)
+		}
+	}
+	return
+}
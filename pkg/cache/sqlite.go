@@ -0,0 +1,135 @@
+// +build cgo
+
+package cache
+
+import (
+	"database/sql"
+	"net/url"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	RegisterDriver("sqlite", openSQLiteBackend)
+}
+
+// sqliteBackend stores the entries of all the buckets in a single table of a SQLite database
+type sqliteBackend struct {
+	db   *sql.DB
+	path string
+}
+
+func openSQLiteBackend(u *url.URL) (Backend, error) {
+	path := urlPath(u)
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=1000&_journal_mode=WAL")
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS entries (
+			bucket TEXT NOT NULL,
+			key BLOB NOT NULL,
+			value BLOB NOT NULL,
+			PRIMARY KEY (bucket, key)
+		) WITHOUT ROWID`)
+	}
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+	return &sqliteBackend{db, path}, nil
+}
+
+func (b *sqliteBackend) Bucket(name string) (Bucket, error) {
+	return &sqliteBucket{b.db, name}, nil
+}
+
+func (b *sqliteBackend) String() string {
+	return "sqlite://" + b.path
+}
+
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
+
+// DBStats returns the statistics of all the buckets of the database
+func (b *sqliteBackend) DBStats() (st DBStats, err error) {
+	st.Path = b.String()
+	var pageSize, pageCount, freeCount int64
+	for query, dest := range map[string]*int64{
+		"PRAGMA page_size":      &pageSize,
+		"PRAGMA page_count":     &pageCount,
+		"PRAGMA freelist_count": &freeCount,
+	} {
+		if err = b.db.QueryRow(query).Scan(dest); err != nil {
+			return
+		}
+	}
+	st.Size, st.Free = pageCount*pageSize, freeCount*pageSize
+
+	rows, err := b.db.Query("SELECT bucket, COUNT(*), SUM(LENGTH(key) + LENGTH(value)) FROM entries GROUP BY bucket ORDER BY bucket")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bst BucketStats
+		if err = rows.Scan(&bst.Name, &bst.Entries, &bst.Bytes); err != nil {
+			return
+		}
+		st.Buckets = append(st.Buckets, bst)
+	}
+	err = rows.Err()
+	return
+}
+
+// Compact rebuilds the database
+func (b *sqliteBackend) Compact() error {
+	_, err := b.db.Exec("VACUUM")
+	return err
+}
+
+type sqliteBucket struct {
+	db   *sql.DB
+	name string
+}
+
+func (b *sqliteBucket) Get(key []byte) (value []byte, err error) {
+	err = b.db.QueryRow("SELECT value FROM entries WHERE bucket = ? AND key = ?", b.name, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+func (b *sqliteBucket) Put(key, value []byte) error {
+	_, err := b.db.Exec("INSERT OR REPLACE INTO entries (bucket, key, value) VALUES (?, ?, ?)", b.name, key, value)
+	return err
+}
+
+func (b *sqliteBucket) Delete(key []byte) error {
+	_, err := b.db.Exec("DELETE FROM entries WHERE bucket = ? AND key = ?", b.name, key)
+	return err
+}
+
+func (b *sqliteBucket) ForEach(fn func(key, value []byte) error) error {
+	rows, err := b.db.Query("SELECT key, value FROM entries WHERE bucket = ? ORDER BY key", b.name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value sql.RawBytes
+		if err = rows.Scan(&key, &value); err == nil {
+			err = fn(key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (b *sqliteBucket) Clear() error {
+	_, err := b.db.Exec("DELETE FROM entries WHERE bucket = ?", b.name)
+	return err
+}
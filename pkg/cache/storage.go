@@ -1,9 +1,7 @@
 package cache
 
 import (
-	"bytes"
 	"encoding"
-	"encoding/gob"
 	"fmt"
 	"reflect"
 	"sync"
@@ -27,30 +25,35 @@ type Flusher interface {
 	Flush()
 }
 
-type boltDBStorage struct {
-	db     *bolt.DB
-	bucket []byte
-	t      reflect.Type
-	l      logging.Logger
+// backendStorage stores the values in a bucket of a Backend
+type backendStorage struct {
+	backend Backend
+	bucket  Bucket
+	name    string
+	t       reflect.Type
+	codec   Codec
+	l       logging.Logger
+	// outdated is true if the schema of the bucket changed, but the bucket has been opened read-only
+	outdated bool
 }
 
-func NewBoltDBStorage(db *bolt.DB, bucket string, sample interface{}, l logging.Logger) Storage {
-	s := &boltDBStorage{db, []byte(bucket), reflect.ValueOf(sample).Type(), l}
-	err := db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(s.bucket)
-		if err == nil {
-			st := b.Stats()
-			s.l.Infof("%d entries in bucket %q", st.KeyN, bucket)
-		}
-		return err
-	})
-	if err != nil {
+// NewBackendStorage stores the values in a bucket of b, encoded with GobCodec.
+// The stored entries are migrated or dropped if the schema of the bucket changed, see SchemaVersioner.
+func NewBackendStorage(b Backend, bucket string, sample interface{}, l logging.Logger) Storage {
+	s := &backendStorage{b, nil, bucket, reflect.ValueOf(sample).Type(), GobCodec, l, false}
+	var err error
+	if s.bucket, err = OpenBucket(b, bucket, sample, l); err != nil {
 		panic(err)
 	}
 	return s
 }
 
-func (s *boltDBStorage) serializeKey(key interface{}) (bkey []byte) {
+// NewBoltDBStorage stores the values in a bucket of db
+func NewBoltDBStorage(db *bolt.DB, bucket string, sample interface{}, l logging.Logger) Storage {
+	return NewBackendStorage(&BoltBackend{db}, bucket, sample, l)
+}
+
+func (s *backendStorage) serializeKey(key interface{}) (bkey []byte) {
 	var err error
 	switch v := key.(type) {
 	case encoding.BinaryMarshaler:
@@ -70,9 +73,9 @@ func (s *boltDBStorage) serializeKey(key interface{}) (bkey []byte) {
 	return
 }
 
-func (s *boltDBStorage) serialize(value interface{}) (buf *buffer.Buffer) {
+func (s *backendStorage) serialize(value interface{}) (buf *buffer.Buffer) {
 	buf = bufferPool.Get()
-	if err := gob.NewEncoder(buf).Encode(value); err != nil {
+	if err := s.codec.Encode(buf, value); err != nil {
 		s.l.Error(err, value)
 		buf.Free()
 		buf = nil
@@ -80,64 +83,53 @@ func (s *boltDBStorage) serialize(value interface{}) (buf *buffer.Buffer) {
 	return
 }
 
-func (s *boltDBStorage) unserialize(data []byte) (value interface{}) {
-	rval := reflect.New(s.t)
-	err := gob.NewDecoder(bytes.NewBuffer(data)).DecodeValue(rval)
+func (s *backendStorage) unserialize(data []byte) (value interface{}) {
+	value, err := s.decode(data)
 	if err != nil {
 		s.l.Error(err, data)
 		return nil
 	}
-	return rval.Interface()
+	return
 }
 
-func (s *boltDBStorage) Store(key, value interface{}) {
+func (s *backendStorage) decode(data []byte) (interface{}, error) {
+	value := reflect.New(s.t).Interface()
+	if err := s.codec.Decode(data, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s *backendStorage) Store(key, value interface{}) {
 	bvalue := s.serialize(value)
 	if bvalue == nil {
 		return
 	}
 	defer bvalue.Free()
-	bkey := s.serializeKey(key)
-
-	s.batch(func(tx *bolt.Tx) error {
-		return tx.Bucket(s.bucket).Put(bkey, bvalue.Bytes())
-	})
-}
-
-// Get reads directly the entry in the internal buffer.
-func (s *boltDBStorage) Fetch(key interface{}) (value interface{}) {
-	bkey := s.serializeKey(key)
-	s.view(func(tx *bolt.Tx) error {
-		bvalue := tx.Bucket(s.bucket).Get(bkey)
-		if bvalue != nil {
-			value = s.unserialize(bvalue)
-		}
-		return nil
-	})
-	return
-}
-
-func (s *boltDBStorage) Delete(key interface{}) {
-	bkey := s.serializeKey(key)
-	s.batch(func(tx *bolt.Tx) error {
-		return tx.Bucket(s.bucket).Delete(bkey)
-	})
+	if err := s.bucket.Put(s.serializeKey(key), bvalue.Bytes()); err != nil {
+		s.l.Error(err)
+	}
 }
 
-func (s *boltDBStorage) view(fn func(tx *bolt.Tx) error) {
-	if err := s.db.View(fn); err != nil {
+func (s *backendStorage) Fetch(key interface{}) (value interface{}) {
+	bvalue, err := s.bucket.Get(s.serializeKey(key))
+	if err != nil {
 		s.l.Error(err)
+	} else if bvalue != nil {
+		value = s.unserialize(bvalue)
 	}
+	return
 }
 
-func (s *boltDBStorage) batch(fn func(tx *bolt.Tx) error) {
-	if err := s.db.Batch(fn); err != nil {
+func (s *backendStorage) Delete(key interface{}) {
+	if err := s.bucket.Delete(s.serializeKey(key)); err != nil {
 		s.l.Error(err)
 	}
 }
 
-func (s *boltDBStorage) Flush() {
-	if err := s.db.Sync(); err != nil {
-		s.l.Error(err)
+func (s *backendStorage) Flush() {
+	if fl, ok := s.backend.(Flusher); ok {
+		fl.Flush()
 	}
 }
 
@@ -194,6 +186,14 @@ func (s *CombinedStorage) Delete(key interface{}) {
 	s.SndLevel.Delete(key)
 }
 
+// Stats returns the statistics of the first level
+func (s *CombinedStorage) Stats() (st Stats) {
+	if r, ok := s.FstLevel.(StatsReporter); ok {
+		st = r.Stats()
+	}
+	return
+}
+
 func (s *CombinedStorage) Flush() {
 	if fl, ok := s.FstLevel.(Flusher); ok {
 		fl.Flush()
@@ -3,7 +3,6 @@ package cds
 import (
 	"context"
 	"encoding/gob"
-	"fmt"
 	"time"
 
 	"github.com/Adirelle/dms/pkg/cache"
@@ -36,11 +35,12 @@ func NewCache(d ContentDirectory, cm *cache.Manager, l logging.Logger) *Cache {
 
 func (c *Cache) Get(id filesystem.ID, ctx context.Context) (*Object, error) {
 	select {
-	case res, ok := <-c.m.Get(id):
-		if ok {
-			return res.(*Object), nil
+	case res := <-c.m.Get(id):
+		value, err := res.Value()
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("could not fetch %q", id)
+		return value.(*Object), nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
@@ -50,6 +50,14 @@ func (c *Cache) GetChildren(id filesystem.ID, ctx context.Context) ([]*Object, e
 	return getChildren(c, id, ctx)
 }
 
+// Invalidate removes the given objects, and their parents, from the cache.
+func (c *Cache) Invalidate(ids []filesystem.ID) {
+	for _, id := range ids {
+		c.m.Delete(id)
+		c.m.Delete(id.ParentID())
+	}
+}
+
 func (c *Cache) loader(key interface{}) (interface{}, error) {
 	local, cancel := context.WithTimeout(c.ctx, LoaderTimeout)
 	defer cancel()
@@ -2,6 +2,7 @@ package cds
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"time"
 
@@ -71,6 +72,45 @@ func getChildren(d ContentDirectory, id filesystem.ID, ctx context.Context) (chi
 	return
 }
 
+// MaxWalkDepth is the maximum depth of the containers explored by Walk
+const MaxWalkDepth = 32
+
+// SkipContainer can be returned by a WalkFunc so Walk does not explore the container passed to it
+var SkipContainer = errors.New("skip this container")
+
+// WalkFunc is called by Walk for each descendant of the starting container
+type WalkFunc func(*Object) error
+
+// Walk calls fn for each descendant of the container identified by id, depth-first.
+// Each container is explored once, down to MaxWalkDepth, so the cycles of the virtual containers are harmless.
+func Walk(d ContentDirectory, id filesystem.ID, ctx context.Context, fn WalkFunc) error {
+	return walk(d, id, ctx, fn, map[filesystem.ID]bool{id: true}, 0)
+}
+
+func walk(d ContentDirectory, id filesystem.ID, ctx context.Context, fn WalkFunc, visited map[filesystem.ID]bool, depth int) error {
+	children, err := d.GetChildren(id, ctx)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child.IsContainer() && visited[child.ID] {
+			continue
+		}
+		if err = fn(child); err == SkipContainer {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if child.IsContainer() && depth < MaxWalkDepth {
+			visited[child.ID] = true
+			if err = walk(d, child.ID, ctx, fn, visited, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 type sortableObjectList []*Object
 
 func (l sortableObjectList) Len() int      { return len(l) }
@@ -2,10 +2,16 @@ package cds
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Adirelle/dms/pkg/dlna"
 	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/dms/pkg/renderer"
 	adi_http "github.com/Adirelle/go-libs/http"
 	"github.com/gorilla/mux"
 )
@@ -65,8 +71,39 @@ func (h *DirectoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.Handler.ServeObject(w, r, o)
 }
 
+// TimeSeeker serves time ranges of objects, as requested with the TimeSeekRange.dlna.org header
+type TimeSeeker interface {
+	CanTimeSeek(*Object) bool
+	ServeTimeRange(http.ResponseWriter, *http.Request, *Object, dlna.NPTRange)
+}
+
+// CaptionLocator finds the subtitles of objects, for the renderers that request them with HTTP headers
+type CaptionLocator interface {
+	CaptionURL(*Object, context.Context) *adi_http.URLSpec
+}
+
+// PlayRecorder records the audio and video items served by the FileServer
+type PlayRecorder interface {
+	Played(*Object, time.Time)
+}
+
+// ContentOpener opens the objects that are not plain files, e.g. the entries of archives.
+// The content is served with range support if the reader implements io.Seeker.
+type ContentOpener interface {
+	CanOpen(*Object) bool
+	Open(*Object) (io.ReadCloser, error)
+}
+
 type FileServer struct {
 	DirectoryHandler
+	// TimeSeeker is optional, time seeking is disabled if it is nil
+	TimeSeeker TimeSeeker
+	// Captions is optional
+	Captions CaptionLocator
+	// History is optional
+	History PlayRecorder
+	// Opener is optional, only plain files are served if it is nil
+	Opener ContentOpener
 }
 
 func NewFileServer(d ContentDirectory) *FileServer {
@@ -80,25 +117,115 @@ func (FileServer) String() string {
 }
 
 func (s *FileServer) ServeObject(w http.ResponseWriter, r *http.Request, obj *Object) {
-	fh, err := os.Open(obj.FilePath)
+	if s.History != nil && r.Method == http.MethodGet && (obj.MimeType.Type == "audio" || obj.MimeType.Type == "video") && isPlayStart(r) {
+		s.History.Played(obj, time.Now())
+	}
+	if h := r.Header.Get(dlna.TimeSeekRangeHeader); h != "" {
+		s.serveTimeRange(w, r, obj, h)
+		return
+	}
+	content, err := s.open(obj)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer fh.Close()
+	defer content.Close()
 	w.Header().Set("Content-Type", obj.MimeType.Value)
-	http.ServeContent(w, r, obj.Name, obj.ModTime, fh)
+	prf := renderer.FromContext(r.Context())
+	prf.SetHeaders(w.Header())
+	if prf.CaptionInfoHeader && r.Header.Get(renderer.GetCaptionInfoHeader) != "" {
+		s.setCaptionInfo(w, r, obj)
+	}
+	if rs, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, obj.Name, obj.ModTime, rs)
+		return
+	}
+	// Stream the content, without range support
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	w.Header().Set("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	if r.Method != http.MethodHead {
+		io.Copy(w, content)
+	}
+}
+
+func (s *FileServer) open(obj *Object) (io.ReadCloser, error) {
+	if s.opens(obj) {
+		return s.Opener.Open(obj)
+	}
+	return os.Open(obj.FilePath)
+}
+
+func (s *FileServer) opens(obj *Object) bool {
+	return s.Opener != nil && s.Opener.CanOpen(obj)
+}
+
+func (s *FileServer) setCaptionInfo(w http.ResponseWriter, r *http.Request, obj *Object) {
+	if s.Captions == nil {
+		return
+	}
+	spec := s.Captions.CaptionURL(obj, r.Context())
+	if spec == nil {
+		return
+	}
+	if url, err := adi_http.URLGeneratorFromContext(r.Context()).URL(spec); err == nil {
+		w.Header().Set(renderer.CaptionInfoHeader, url)
+	}
+}
+
+// isPlayStart returns true if the request reads the content from its beginning.
+// The renderers often send several requests per playback, e.g. to seek or to read the metadata at the end of the file.
+func isPlayStart(r *http.Request) bool {
+	if h := r.Header.Get("Range"); h != "" {
+		h = strings.TrimSpace(h)
+		return strings.HasPrefix(h, "bytes=0-") && !strings.Contains(h, ",")
+	}
+	if h := r.Header.Get(dlna.TimeSeekRangeHeader); h != "" {
+		rng, err := dlna.ParseNPTRange(h)
+		return err == nil && rng.Start == 0
+	}
+	return true
+}
+
+func (s *FileServer) serveTimeRange(w http.ResponseWriter, r *http.Request, obj *Object, header string) {
+	if !s.canTimeSeek(obj) {
+		http.Error(w, "Time seeking is not supported", http.StatusNotAcceptable)
+		return
+	}
+	rng, err := dlna.ParseNPTRange(header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	s.TimeSeeker.ServeTimeRange(w, r, obj, rng)
+}
+
+func (s *FileServer) canTimeSeek(obj *Object) bool {
+	return s.TimeSeeker != nil && !s.opens(obj) && s.TimeSeeker.CanTimeSeek(obj)
 }
 
 func (s *FileServer) Process(obj *Object, _ context.Context) {
-	if !obj.IsContainer() {
-		obj.AddResource(Resource{
-			URL:          FileServerURLSpec(obj.ID),
-			Size:         uint64(obj.Size),
-			ProtocolInfo: ProtocolInfo{MimeType: obj.MimeType},
-			FilePath:     obj.FilePath,
-		})
+	if obj.IsContainer() {
+		return
+	}
+	res := Resource{
+		URL:          FileServerURLSpec(obj.ID),
+		Size:         uint64(obj.Size),
+		ProtocolInfo: ProtocolInfo{MimeType: obj.MimeType},
+		FilePath:     obj.FilePath,
+	}
+	if s.canTimeSeek(obj) {
+		res.ProtocolInfo.Set(DLNAOperation, dlna.OpBothSeeks)
+	} else {
+		res.ProtocolInfo.Set(DLNAOperation, dlna.OpByteSeek)
+	}
+	res.ProtocolInfo.Set(DLNAConversion, dlna.NotConverted)
+	if obj.MimeType.Type == "image" {
+		res.ProtocolInfo.Set(DLNAFlags, dlna.InteractiveFlags.String())
+	} else {
+		res.ProtocolInfo.Set(DLNAFlags, dlna.StreamingFlags.String())
 	}
+	obj.AddResource(res)
 }
 
 func FileServerURLSpec(id filesystem.ID) *adi_http.URLSpec {
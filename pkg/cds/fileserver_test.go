@@ -0,0 +1,33 @@
+package cds
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adirelle/dms/pkg/dlna"
+)
+
+func TestIsPlayStart(t *testing.T) {
+	data := []struct {
+		header, value string
+		expected      bool
+	}{
+		{"", "", true},
+		{"Range", "bytes=0-", true},
+		{"Range", "bytes=0-1023", true},
+		{"Range", "bytes=1024-", false},
+		{"Range", "bytes=-128", false},
+		{"Range", "bytes=0-10,100-200", false},
+		{dlna.TimeSeekRangeHeader, "npt=0-", true},
+		{dlna.TimeSeekRangeHeader, "npt=0:01:00-", false},
+	}
+	for _, d := range data {
+		r := httptest.NewRequest("GET", "/", nil)
+		if d.header != "" {
+			r.Header.Set(d.header, d.value)
+		}
+		if actual := isPlayStart(r); actual != d.expected {
+			t.Errorf("%s: %q, expected %v, got %v", d.header, d.value, d.expected, actual)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package cds
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -25,12 +26,30 @@ type Object struct {
 	Date        time.Time
 	Genre       string
 	Icon        *http.URLSpec
+	TrackNumber int
+
+	// AlbumArtProfileID is the DLNA profile of the album art, e.g. "JPEG_TN"
+	AlbumArtProfileID string
+
+	// UPnPClass overrides the default class of the object, e.g. "object.container.album.musicAlbum"
+	UPnPClass string
+
+	// RefID is the ID of the item this one refers to, e.g. for the items listed in virtual containers
+	RefID filesystem.ID
 
 	Resources []Resource
+	Captions  []Caption
 
 	MimeType types.MIME
 }
 
+// Caption is a subtitle track of a video
+type Caption struct {
+	URL *http.URLSpec
+	// Type is the subtitle format, e.g. "srt" or "vtt"
+	Type string
+}
+
 func newObject(obj *filesystem.Object) (o *Object, err error) {
 	o = &Object{Object: *obj}
 	o.Title, o.MimeType, err = guessMimeType(o)
@@ -62,7 +81,19 @@ func (o *Object) IsContainer() bool {
 	return o.IsDir
 }
 
-func (o *Object) MarshalDIDLLite(gen http.URLGenerator) (res didl_lite.Object, err error) {
+// Class returns the UPnP class of the object
+func (o *Object) Class() string {
+	if o.UPnPClass != "" {
+		return o.UPnPClass
+	}
+	if o.IsContainer() {
+		return "object.container"
+	}
+	return "object.item." + o.MimeType.Type + "Item"
+}
+
+// MarshalDIDLLite converts the object into DIDL-Lite, only including the optional properties selected by the filter.
+func (o *Object) MarshalDIDLLite(gen http.URLGenerator, filter didl_lite.Filter) (res didl_lite.Object, err error) {
 
 	cm := didl_lite.Common{
 		ID:         o.ID.String(),
@@ -71,62 +102,87 @@ func (o *Object) MarshalDIDLLite(gen http.URLGenerator) (res didl_lite.Object, e
 		Title:      o.Title,
 	}
 
+	setTag := func(name, value string) {
+		if filter.Includes(name) {
+			cm.Tags.Set(name, value)
+		}
+	}
+
 	if !o.Date.IsZero() {
-		cm.Tags.Set(didl_lite.TagDate, o.Date.Format(time.RFC3339))
+		setTag(didl_lite.TagDate, o.Date.Format(time.RFC3339))
 	}
 	if o.Artist != "" {
-		cm.Tags.Set(didl_lite.TagArtist, o.Artist)
+		setTag(didl_lite.TagArtist, o.Artist)
 	}
 	if o.Album != "" {
-		cm.Tags.Set(didl_lite.TagAlbum, o.Album)
+		setTag(didl_lite.TagAlbum, o.Album)
 	}
 	if o.Genre != "" {
-		cm.Tags.Set(didl_lite.TagGenre, o.Genre)
+		setTag(didl_lite.TagGenre, o.Genre)
+	}
+	if o.TrackNumber != 0 {
+		setTag(didl_lite.TagOriginalTrackNumber, strconv.Itoa(o.TrackNumber))
 	}
 
 	var url string
-	if o.Icon != nil {
+	if o.Icon != nil && filter.Includes(didl_lite.TagIcon) {
 		if url, err = gen.URL(o.Icon); err == nil {
-			cm.Tags.Set(didl_lite.TagIcon, url)
+			setTag(didl_lite.TagIcon, url)
 		} else {
 			return
 		}
 	}
 
-	if o.AlbumArtURI != nil {
+	if o.AlbumArtURI != nil && filter.Includes(didl_lite.TagAlbumArtURI) {
 		if url, err = gen.URL(o.AlbumArtURI); err == nil {
-			cm.Tags.Set(didl_lite.TagAlbumArtURI, url)
+			setTag(didl_lite.TagAlbumArtURI, url)
+			if o.AlbumArtProfileID != "" {
+				cm.Tags.Set(didl_lite.TagAlbumArtURI+"@"+didl_lite.AttrProfileID, o.AlbumArtProfileID)
+			}
 		} else {
 			return
 		}
 	}
 
-	for _, r := range o.Resources {
-		var didlres didl_lite.Resource
-		didlres, err = r.MarshalDIDLLite(gen)
-		if err != nil {
-			return
+	if filter.Includes(didl_lite.TagResource) {
+		for _, r := range o.Resources {
+			var didlres didl_lite.Resource
+			didlres, err = r.MarshalDIDLLite(gen, filter)
+			if err != nil {
+				return
+			}
+			cm.AddResources(didlres)
 		}
-		cm.AddResources(didlres)
 	}
 
+	if filter.Includes(didl_lite.TagCaptionInfoEx) {
+		for _, c := range o.Captions {
+			if url, err = gen.URL(c.URL); err != nil {
+				return
+			}
+			cm.Captions = append(cm.Captions, didl_lite.CaptionInfo{Type: c.Type, URI: url})
+		}
+	}
+
+	cm.Class = o.Class()
 	if o.IsContainer() {
-		cm.Class = "object.container"
-		res = &didl_lite.Container{
-			Common:     cm,
-			ChildCount: uint(len(o.ChildrenID)),
+		ctn := &didl_lite.Container{Common: cm}
+		if filter.Includes(didl_lite.AttrChildCount) {
+			ctn.ChildCount = uint(len(o.ChildrenID))
 		}
+		res = ctn
 	} else {
-		cm.Class = "object.item." + o.MimeType.Type + "Item"
-		res = &didl_lite.Item{Common: cm}
+		res = &didl_lite.Item{Common: cm, RefID: o.RefID.String()}
 	}
 
 	return
 }
 
 type Resource struct {
-	URL  *http.URLSpec
-	Size uint64
+	URL *http.URLSpec
+	// RemoteURL is used when URL is nil, for the resources served by other hosts
+	RemoteURL string
+	Size      uint64
 	ProtocolInfo
 
 	Duration        time.Duration
@@ -145,37 +201,42 @@ func (r *Resource) Owner() *Object {
 	return r.owner
 }
 
-func (r *Resource) MarshalDIDLLite(gen http.URLGenerator) (res didl_lite.Resource, err error) {
-	url, err := gen.URL(r.URL)
-	if err != nil {
-		return
+// MarshalDIDLLite converts the resource into DIDL-Lite, only including the attributes selected by the filter.
+func (r *Resource) MarshalDIDLLite(gen http.URLGenerator, filter didl_lite.Filter) (res didl_lite.Resource, err error) {
+	url := r.RemoteURL
+	if r.URL != nil {
+		if url, err = gen.URL(r.URL); err != nil {
+			return
+		}
 	}
 	res = didl_lite.Resource{
 		ProtocolInfo: r.ProtocolInfo.String(),
 		URI:          url,
 	}
-	res.SetTag(didl_lite.ResSize, strconv.FormatUint(r.Size, 10))
-
+	if r.Size != 0 {
+		// Transcoded streams have no known size
+		res.SetFilteredTag(filter, didl_lite.ResSize, strconv.FormatUint(r.Size, 10))
+	}
 	if r.Duration != 0 {
-		res.SetTag(didl_lite.ResDuration, didl_lite.Duration(r.Duration).String())
+		res.SetFilteredTag(filter, didl_lite.ResDuration, didl_lite.Duration(r.Duration).String())
 	}
 	if r.Bitrate != 0 {
-		res.SetTag(didl_lite.ResBitrate, strconv.FormatUint(uint64(r.Bitrate), 10))
+		res.SetFilteredTag(filter, didl_lite.ResBitrate, strconv.FormatUint(uint64(r.Bitrate), 10))
 	}
 	if r.SampleFrequency != 0 {
-		res.SetTag(didl_lite.ResSampleFrequency, strconv.FormatUint(uint64(r.SampleFrequency), 10))
+		res.SetFilteredTag(filter, didl_lite.ResSampleFrequency, strconv.FormatUint(uint64(r.SampleFrequency), 10))
 	}
 	if r.BitsPerSample != 0 {
-		res.SetTag(didl_lite.ResBitsPerSample, strconv.FormatUint(uint64(r.BitsPerSample), 10))
+		res.SetFilteredTag(filter, didl_lite.ResBitsPerSample, strconv.FormatUint(uint64(r.BitsPerSample), 10))
 	}
 	if r.NrAudioChannels != 0 {
-		res.SetTag(didl_lite.ResNrAudioChannels, strconv.FormatUint(uint64(r.NrAudioChannels), 10))
+		res.SetFilteredTag(filter, didl_lite.ResNrAudioChannels, strconv.FormatUint(uint64(r.NrAudioChannels), 10))
 	}
 	if r.ColorDepth != 0 {
-		res.SetTag(didl_lite.ResColorDepth, strconv.FormatUint(uint64(r.ColorDepth), 10))
+		res.SetFilteredTag(filter, didl_lite.ResColorDepth, strconv.FormatUint(uint64(r.ColorDepth), 10))
 	}
 	if r.Resolution.Width != 0 && r.Resolution.Height != 0 {
-		res.SetTag(didl_lite.ResResolution, r.Resolution.String())
+		res.SetFilteredTag(filter, didl_lite.ResResolution, r.Resolution.String())
 	}
 
 	return
@@ -192,12 +253,15 @@ func (p ProtocolInfo) String() string {
 		contentFormat = p.MimeType.Value
 	}
 	additionalInfo := "*"
-	if p.AdditionalInfo != nil {
-		flags := make([]string, len(p.AdditionalInfo))
-		i := 0
-		for k, v := range p.AdditionalInfo {
-			flags[i] = fmt.Sprintf("%s_%s=%s", k.OrgName, k.Token, v)
-			i++
+	if len(p.AdditionalInfo) > 0 {
+		keys := make([]AddInfoKey, 0, len(p.AdditionalInfo))
+		for k := range p.AdditionalInfo {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+		flags := make([]string, len(keys))
+		for i, k := range keys {
+			flags[i] = fmt.Sprintf("%s_%s=%s", k.OrgName, k.Token, p.AdditionalInfo[k])
 		}
 		additionalInfo = strings.Join(flags, ";")
 	}
@@ -208,3 +272,47 @@ type AddInfoKey struct {
 	OrgName string
 	Token   string
 }
+
+// Keys of the DLNA parameters, in the order they must appear
+var (
+	DLNAProfileName = AddInfoKey{"DLNA.ORG", "PN"}
+	DLNAOperation   = AddInfoKey{"DLNA.ORG", "OP"}
+	DLNAPlaySpeed   = AddInfoKey{"DLNA.ORG", "PS"}
+	DLNAConversion  = AddInfoKey{"DLNA.ORG", "CI"}
+	DLNAFlags       = AddInfoKey{"DLNA.ORG", "FLAGS"}
+)
+
+var dlnaKeyOrder = map[AddInfoKey]int{
+	DLNAProfileName: 1,
+	DLNAOperation:   2,
+	DLNAPlaySpeed:   3,
+	DLNAConversion:  4,
+	DLNAFlags:       5,
+}
+
+// less sorts the DLNA parameters first, in their mandatory order, then the others alphabetically
+func (k AddInfoKey) less(o AddInfoKey) bool {
+	ki, ko := dlnaKeyOrder[k], dlnaKeyOrder[o]
+	switch {
+	case ki != 0 && ko != 0:
+		return ki < ko
+	case ki != 0 || ko != 0:
+		return ki != 0
+	case k.OrgName != o.OrgName:
+		return k.OrgName < o.OrgName
+	}
+	return k.Token < o.Token
+}
+
+// Get returns the value of a parameter of the additional info, or an empty string
+func (p ProtocolInfo) Get(key AddInfoKey) string {
+	return p.AdditionalInfo[key]
+}
+
+// Set sets a parameter of the additional info
+func (p *ProtocolInfo) Set(key AddInfoKey, value string) {
+	if p.AdditionalInfo == nil {
+		p.AdditionalInfo = make(map[AddInfoKey]string)
+	}
+	p.AdditionalInfo[key] = value
+}
@@ -0,0 +1,27 @@
+package cds
+
+import (
+	"testing"
+
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+func TestProtocolInfoString(t *testing.T) {
+	p := ProtocolInfo{MimeType: types.NewMIME("audio/mpeg")}
+	if actual, expected := p.String(), "http-get:*:audio/mpeg:*"; actual != expected {
+		t.Errorf("ProtocolInfo.String(), expected %q, got %q", expected, actual)
+	}
+
+	p.Set(DLNAFlags, "01700000000000000000000000000000")
+	p.Set(AddInfoKey{"ACME.COM", "X"}, "1")
+	p.Set(DLNAConversion, "0")
+	p.Set(DLNAOperation, "01")
+	p.Set(DLNAProfileName, "MP3")
+	expected := "http-get:*:audio/mpeg:DLNA.ORG_PN=MP3;DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000;ACME.COM_X=1"
+	for i := 0; i < 10; i++ {
+		if actual := p.String(); actual != expected {
+			t.Errorf("ProtocolInfo.String(), expected %q, got %q", expected, actual)
+			break
+		}
+	}
+}
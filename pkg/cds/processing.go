@@ -13,11 +13,22 @@ type Processor interface {
 	Process(*Object, context.Context)
 }
 
+// ObjectHider hides objects from the children of their containers. Hidden objects are still available by their ID.
+type ObjectHider interface {
+	Hides(filesystem.ID) bool
+}
+
 // ProcessingDirectory uses processors to enrich the objects
 type ProcessingDirectory struct {
 	ContentDirectory
 	logging.Logger
 	processorList
+	hiders []ObjectHider
+}
+
+// AddHider registers an ObjectHider
+func (d *ProcessingDirectory) AddHider(h ObjectHider) {
+	d.hiders = append(d.hiders, h)
 }
 
 // Get fetchs the Object from the underlying Directory and applies the processors to it
@@ -36,9 +47,31 @@ func (d *ProcessingDirectory) Get(id filesystem.ID, ctx context.Context) (obj *O
 			return nil, p
 		}
 	}
+	if obj.IsContainer() && len(d.hiders) > 0 {
+		obj.ChildrenID = d.visibleChildren(obj.ChildrenID)
+	}
 	return
 }
 
+func (d *ProcessingDirectory) visibleChildren(ids []filesystem.ID) []filesystem.ID {
+	visible := make([]filesystem.ID, 0, len(ids))
+	for _, id := range ids {
+		if !d.hides(id) {
+			visible = append(visible, id)
+		}
+	}
+	return visible
+}
+
+func (d *ProcessingDirectory) hides(id filesystem.ID) bool {
+	for _, h := range d.hiders {
+		if h.Hides(id) {
+			return true
+		}
+	}
+	return false
+}
+
 // Get fetchs the Object from the underlying Directory and applies the processors to it
 func (d *ProcessingDirectory) GetChildren(id filesystem.ID, ctx context.Context) ([]*Object, error) {
 	return getChildren(d, id, ctx)
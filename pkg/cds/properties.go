@@ -0,0 +1,149 @@
+package cds
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/didl_lite"
+)
+
+// property describes an Object property that can be used in search or sort criteria
+type property struct {
+	kind   propertyKind
+	values func(*Object) []interface{}
+}
+
+type propertyKind int
+
+const (
+	stringProperty propertyKind = iota
+	integerProperty
+	dateProperty
+	durationProperty
+)
+
+var properties = map[string]*property{
+	"@id": {stringProperty, func(o *Object) []interface{} {
+		return []interface{}{o.ID.String()}
+	}},
+	"@parentID": {stringProperty, func(o *Object) []interface{} {
+		return []interface{}{o.ID.ParentID().String()}
+	}},
+	"dc:title": {stringProperty, func(o *Object) []interface{} {
+		return stringValues(o.Title)
+	}},
+	"dc:date": {dateProperty, func(o *Object) []interface{} {
+		if o.Date.IsZero() {
+			return nil
+		}
+		return []interface{}{o.Date}
+	}},
+	"upnp:class": {stringProperty, func(o *Object) []interface{} {
+		return []interface{}{o.Class()}
+	}},
+	"upnp:artist": {stringProperty, func(o *Object) []interface{} {
+		return stringValues(o.Artist)
+	}},
+	"upnp:album": {stringProperty, func(o *Object) []interface{} {
+		return stringValues(o.Album)
+	}},
+	"upnp:genre": {stringProperty, func(o *Object) []interface{} {
+		return stringValues(o.Genre)
+	}},
+	"upnp:originalTrackNumber": {integerProperty, func(o *Object) []interface{} {
+		if o.TrackNumber == 0 {
+			return nil
+		}
+		return []interface{}{int64(o.TrackNumber)}
+	}},
+	"res@size": {integerProperty, func(o *Object) (values []interface{}) {
+		for _, r := range o.Resources {
+			values = append(values, int64(r.Size))
+		}
+		return
+	}},
+	"res@duration": {durationProperty, func(o *Object) (values []interface{}) {
+		for _, r := range o.Resources {
+			if r.Duration != 0 {
+				values = append(values, r.Duration)
+			}
+		}
+		return
+	}},
+	"res@protocolInfo": {stringProperty, func(o *Object) (values []interface{}) {
+		for _, r := range o.Resources {
+			values = append(values, r.ProtocolInfo.String())
+		}
+		return
+	}},
+}
+
+func stringValues(s string) []interface{} {
+	if s == "" {
+		return nil
+	}
+	return []interface{}{s}
+}
+
+// propertyNames returns the sorted list of the names of the given properties
+func propertyNames(props map[string]*property) string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// parse converts a literal into a value of the property kind
+func (k propertyKind) parse(s string) (interface{}, error) {
+	switch k {
+	case integerProperty:
+		return strconv.ParseInt(s, 10, 64)
+	case dateProperty:
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date: %q", s)
+	case durationProperty:
+		d, err := didl_lite.ParseDuration(s)
+		return time.Duration(d), err
+	}
+	return s, nil
+}
+
+// compareValues compares two values of the same kind.
+// Strings are compared case-insensitively.
+func compareValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(strings.ToLower(x), strings.ToLower(b.(string)))
+	case int64:
+		return compareInt64(x, b.(int64))
+	case time.Duration:
+		return compareInt64(int64(x), int64(b.(time.Duration)))
+	case time.Time:
+		y := b.(time.Time)
+		if x.Before(y) {
+			return -1
+		} else if x.After(y) {
+			return 1
+		}
+		return 0
+	}
+	panic(fmt.Sprintf("cannot compare values of type %T", a))
+}
+
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
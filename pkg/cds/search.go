@@ -0,0 +1,325 @@
+package cds
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SearchCriteria is a compiled search expression, as defined in section 2.5.5 of the ContentDirectory:1 specification.
+type SearchCriteria interface {
+	Match(*Object) bool
+}
+
+// ParseSearchCriteria compiles a search expression.
+// Both "*" and the empty string match every object.
+func ParseSearchCriteria(s string) (SearchCriteria, error) {
+	if t := strings.TrimSpace(s); t == "" || t == "*" {
+		return matchAll{}, nil
+	}
+	p := &searchParser{input: s}
+	p.next()
+	crit, err := p.parseOr()
+	if err == nil && p.err != nil {
+		err = p.err
+	} else if err == nil && p.tok.typ != tokenEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	return crit, err
+}
+
+type matchAll struct{}
+
+func (matchAll) Match(*Object) bool { return true }
+
+type matchAnd struct{ left, right SearchCriteria }
+
+func (m matchAnd) Match(o *Object) bool { return m.left.Match(o) && m.right.Match(o) }
+
+type matchOr struct{ left, right SearchCriteria }
+
+func (m matchOr) Match(o *Object) bool { return m.left.Match(o) || m.right.Match(o) }
+
+type matchExists struct {
+	prop   *property
+	exists bool
+}
+
+func (m matchExists) Match(o *Object) bool {
+	return (len(m.prop.values(o)) > 0) == m.exists
+}
+
+type valueTest func(v interface{}) bool
+
+// matchValues matches if any value of the property passes the test.
+// If negate is set, it matches if the property has values but none of them passes the test.
+type matchValues struct {
+	prop   *property
+	test   valueTest
+	negate bool
+}
+
+func (m matchValues) Match(o *Object) bool {
+	values := m.prop.values(o)
+	if len(values) == 0 {
+		return false
+	}
+	for _, v := range values {
+		if m.test(v) {
+			return !m.negate
+		}
+	}
+	return m.negate
+}
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenOpenParen
+	tokenCloseParen
+	tokenWord
+	tokenOperator
+	tokenString
+)
+
+type token struct {
+	typ   tokenType
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of input"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.value)
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+type searchParser struct {
+	input string
+	pos   int
+	tok   token
+	err   error
+}
+
+func (p *searchParser) errorf(tpl string, args ...interface{}) error {
+	return fmt.Errorf("invalid search criteria at offset %d: %s", p.tok.pos, fmt.Sprintf(tpl, args...))
+}
+
+// next reads the next token
+func (p *searchParser) next() {
+	for p.pos < len(p.input) && isSearchSpace(p.input[p.pos]) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{tokenEOF, "", start}
+		return
+	}
+	switch c := p.input[p.pos]; {
+	case c == '(':
+		p.pos++
+		p.tok = token{tokenOpenParen, "(", start}
+	case c == ')':
+		p.pos++
+		p.tok = token{tokenCloseParen, ")", start}
+	case c == '"':
+		p.tok = p.readString()
+	case c == '=' || c == '!' || c == '<' || c == '>':
+		p.pos++
+		if p.pos < len(p.input) && p.input[p.pos] == '=' {
+			p.pos++
+		}
+		p.tok = token{tokenOperator, p.input[start:p.pos], start}
+	default:
+		for p.pos < len(p.input) && isSearchWordChar(rune(p.input[p.pos])) {
+			p.pos++
+		}
+		if p.pos == start {
+			p.pos++
+		}
+		p.tok = token{tokenWord, p.input[start:p.pos], start}
+	}
+}
+
+func (p *searchParser) readString() token {
+	start := p.pos
+	p.pos++
+	b := strings.Builder{}
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return token{tokenString, b.String(), start}
+		case '\\':
+			if p.pos < len(p.input) {
+				c = p.input[p.pos]
+				p.pos++
+			}
+		}
+		b.WriteByte(c)
+	}
+	p.err = fmt.Errorf("invalid search criteria at offset %d: unterminated string", start)
+	return token{tokenEOF, "", start}
+}
+
+func isSearchSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isSearchWordChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune(":@._-", c)
+}
+
+func (p *searchParser) isKeyword(kw string) bool {
+	return p.tok.typ == tokenWord && strings.EqualFold(p.tok.value, kw)
+}
+
+// parseOr parses: andExp ('or' andExp)*
+func (p *searchParser) parseOr() (crit SearchCriteria, err error) {
+	if crit, err = p.parseAnd(); err != nil {
+		return
+	}
+	for p.isKeyword("or") {
+		p.next()
+		var right SearchCriteria
+		if right, err = p.parseAnd(); err != nil {
+			return
+		}
+		crit = matchOr{crit, right}
+	}
+	return
+}
+
+// parseAnd parses: primary ('and' primary)*
+func (p *searchParser) parseAnd() (crit SearchCriteria, err error) {
+	if crit, err = p.parsePrimary(); err != nil {
+		return
+	}
+	for p.isKeyword("and") {
+		p.next()
+		var right SearchCriteria
+		if right, err = p.parsePrimary(); err != nil {
+			return
+		}
+		crit = matchAnd{crit, right}
+	}
+	return
+}
+
+// parsePrimary parses: '(' orExp ')' | relExp
+func (p *searchParser) parsePrimary() (crit SearchCriteria, err error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.typ == tokenOpenParen {
+		p.next()
+		if crit, err = p.parseOr(); err != nil {
+			return
+		}
+		if p.tok.typ != tokenCloseParen {
+			return nil, p.errorf("expected \")\", got %s", p.tok)
+		}
+		p.next()
+		return
+	}
+	return p.parseRelation()
+}
+
+// parseRelation parses: property binOp quotedVal | property 'exists' boolVal
+func (p *searchParser) parseRelation() (SearchCriteria, error) {
+	if p.tok.typ != tokenWord {
+		return nil, p.errorf("expected property name, got %s", p.tok)
+	}
+	name := p.tok.value
+	prop, known := properties[name]
+	if !known {
+		return nil, p.errorf("unsupported property %q", name)
+	}
+	p.next()
+
+	if p.isKeyword("exists") {
+		p.next()
+		var exists bool
+		switch {
+		case p.isKeyword("true"):
+			exists = true
+		case p.isKeyword("false"):
+			exists = false
+		default:
+			return nil, p.errorf("expected true or false, got %s", p.tok)
+		}
+		p.next()
+		return matchExists{prop, exists}, nil
+	}
+
+	if p.tok.typ != tokenOperator && p.tok.typ != tokenWord {
+		return nil, p.errorf("expected operator, got %s", p.tok)
+	}
+	op := p.tok
+	p.next()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.typ != tokenString {
+		return nil, p.errorf("expected quoted value, got %s", p.tok)
+	}
+	literal := p.tok.value
+	p.next()
+
+	if op.typ == tokenWord {
+		return p.stringOperation(name, prop, op, literal)
+	}
+
+	value, err := prop.kind.parse(literal)
+	if err != nil {
+		return nil, p.errorf("invalid value for %s: %s", name, err)
+	}
+	cmp := func(v interface{}) int { return compareValues(v, value) }
+	switch op.value {
+	case "=":
+		return matchValues{prop, func(v interface{}) bool { return cmp(v) == 0 }, false}, nil
+	case "!=":
+		return matchValues{prop, func(v interface{}) bool { return cmp(v) == 0 }, true}, nil
+	case "<":
+		return matchValues{prop, func(v interface{}) bool { return cmp(v) < 0 }, false}, nil
+	case "<=":
+		return matchValues{prop, func(v interface{}) bool { return cmp(v) <= 0 }, false}, nil
+	case ">":
+		return matchValues{prop, func(v interface{}) bool { return cmp(v) > 0 }, false}, nil
+	case ">=":
+		return matchValues{prop, func(v interface{}) bool { return cmp(v) >= 0 }, false}, nil
+	}
+	return nil, fmt.Errorf("invalid search criteria at offset %d: unknown operator %q", op.pos, op.value)
+}
+
+func (p *searchParser) stringOperation(name string, prop *property, op token, literal string) (SearchCriteria, error) {
+	if prop.kind != stringProperty {
+		return nil, fmt.Errorf("invalid search criteria at offset %d: %s cannot be used with %s", op.pos, op.value, name)
+	}
+	needle := strings.ToLower(literal)
+	contains := func(v interface{}) bool {
+		return strings.Contains(strings.ToLower(v.(string)), needle)
+	}
+	switch strings.ToLower(op.value) {
+	case "contains":
+		return matchValues{prop, contains, false}, nil
+	case "doesnotcontain":
+		return matchValues{prop, contains, true}, nil
+	case "startswith":
+		return matchValues{prop, func(v interface{}) bool {
+			return strings.HasPrefix(strings.ToLower(v.(string)), needle)
+		}, false}, nil
+	case "derivedfrom":
+		return matchValues{prop, func(v interface{}) bool {
+			s := strings.ToLower(v.(string))
+			return s == needle || strings.HasPrefix(s, needle+".")
+		}, false}, nil
+	}
+	return nil, fmt.Errorf("invalid search criteria at offset %d: unknown operator %q", op.pos, op.value)
+}
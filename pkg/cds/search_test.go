@@ -0,0 +1,72 @@
+package cds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+func TestParseSearchCriteria(t *testing.T) {
+	obj := &Object{
+		Object:   filesystem.Object{ID: filesystem.ID("/music/track.mp3")},
+		Title:    "Some Track",
+		Artist:   "The \"Band\"",
+		Album:    "Greatest Hits",
+		Date:     time.Date(2010, 5, 1, 0, 0, 0, 0, time.UTC),
+		MimeType: types.NewMIME("audio/mpeg"),
+		Resources: []Resource{
+			{Size: 1000, Duration: 3 * time.Minute},
+		},
+	}
+
+	var data = map[string]bool{
+		`*`:                                            true,
+		`dc:title = "some track"`:                      true,
+		`dc:title != "Some Track"`:                     false,
+		`dc:title contains "track"`:                    true,
+		`dc:title doesNotContain "track"`:              false,
+		`upnp:artist = "The \"Band\""`:                 true,
+		`upnp:class derivedfrom "object.item"`:         true,
+		`upnp:class derivedfrom "object.container"`:    false,
+		`upnp:class derivedfrom "object.item.audio"`:   false,
+		`upnp:genre exists true`:                       false,
+		`upnp:genre exists false`:                      true,
+		`res@size > "999"`:                             true,
+		`res@size <= "999"`:                            false,
+		`res@duration >= "0:03:00"`:                    true,
+		`dc:date < "2011-01-01"`:                       true,
+		`@parentID = "/music"`:                         true,
+		`upnp:album = "x" or dc:title contains "Some"`: true,
+		`upnp:album = "x" or dc:title contains "Some" and upnp:genre = "y"`:          false,
+		`(upnp:album = "x" or dc:title contains "Some") and upnp:genre exists false`: true,
+	}
+	for input, expected := range data {
+		crit, err := ParseSearchCriteria(input)
+		if err != nil {
+			t.Errorf("ParseSearchCriteria(%s) returned unexpected error: %s", input, err)
+		} else if actual := crit.Match(obj); actual != expected {
+			t.Errorf("ParseSearchCriteria(%s), expected %v, got %v", input, expected, actual)
+		}
+	}
+}
+
+func TestParseSearchCriteriaErrors(t *testing.T) {
+	var data = []string{
+		`dc:title`,
+		`dc:title = `,
+		`dc:title = "unterminated`,
+		`dc:foo = "bar"`,
+		`res@size contains "1"`,
+		`res@size = "abc"`,
+		`(dc:title = "a"`,
+		`dc:title = "a" dc:title = "b"`,
+		`dc:title exists maybe`,
+	}
+	for _, input := range data {
+		if _, err := ParseSearchCriteria(input); err == nil {
+			t.Errorf("ParseSearchCriteria(%s) should have failed", input)
+		}
+	}
+}
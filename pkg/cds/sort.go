@@ -0,0 +1,100 @@
+package cds
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sortProperties lists the properties that can be used in sort criteria
+var sortProperties = []string{
+	"dc:title",
+	"dc:date",
+	"upnp:artist",
+	"upnp:album",
+	"upnp:genre",
+	"upnp:originalTrackNumber",
+	"res@size",
+	"res@duration",
+}
+
+// SortCapabilities is the value returned by GetSortCapabilities
+var SortCapabilities = strings.Join(sortProperties, ",")
+
+// SortCriteria is a parsed list of sort keys, as defined in section 2.5.7 of the ContentDirectory:1 specification.
+type SortCriteria []sortKey
+
+type sortKey struct {
+	prop       *property
+	descending bool
+}
+
+// ParseSortCriteria parses a comma-separated list of properties, each one prefixed by "+" (ascending) or "-" (descending).
+// Properties without prefix are sorted in ascending order.
+func ParseSortCriteria(s string) (crit SortCriteria, err error) {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := sortKey{}
+		switch part[0] {
+		case '-':
+			key.descending = true
+			fallthrough
+		case '+':
+			part = part[1:]
+		}
+		if !isSortProperty(part) {
+			return nil, fmt.Errorf("unsupported sort property %q", part)
+		}
+		key.prop = properties[part]
+		crit = append(crit, key)
+	}
+	return
+}
+
+func isSortProperty(name string) bool {
+	for _, n := range sortProperties {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort sorts the objects in place. The sort is stable so objects that compare equal keep their original order.
+func (c SortCriteria) Sort(objs []*Object) {
+	if len(c) == 0 {
+		return
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return c.compare(objs[i], objs[j]) < 0
+	})
+}
+
+func (c SortCriteria) compare(a, b *Object) int {
+	for _, key := range c {
+		res := compareFirstValues(key.prop.values(a), key.prop.values(b))
+		if key.descending {
+			res = -res
+		}
+		if res != 0 {
+			return res
+		}
+	}
+	return 0
+}
+
+// compareFirstValues compares the first values of each list. Missing values come first.
+func compareFirstValues(a, b []interface{}) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return -1
+	case len(b) == 0:
+		return 1
+	}
+	return compareValues(a[0], b[0])
+}
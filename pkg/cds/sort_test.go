@@ -0,0 +1,39 @@
+package cds
+
+import (
+	"testing"
+
+	"github.com/Adirelle/dms/pkg/filesystem"
+)
+
+func TestSortCriteria(t *testing.T) {
+	newObj := func(id, album string, track int) *Object {
+		return &Object{Object: filesystem.Object{ID: filesystem.ID(id)}, Title: id, Album: album, TrackNumber: track}
+	}
+	var data = map[string][]string{
+		"":                                      {"/a", "/b", "/c", "/d"},
+		"+dc:title":                             {"/a", "/b", "/c", "/d"},
+		"-dc:title":                             {"/d", "/c", "/b", "/a"},
+		"+upnp:album,-upnp:originalTrackNumber": {"/d", "/c", "/b", "/a"},
+		"-upnp:album,+upnp:originalTrackNumber": {"/a", "/b", "/c", "/d"},
+		"+upnp:album":                           {"/d", "/b", "/c", "/a"},
+	}
+	for input, expected := range data {
+		objs := []*Object{newObj("/a", "Y", 1), newObj("/b", "X", 1), newObj("/c", "X", 2), newObj("/d", "", 0)}
+		crit, err := ParseSortCriteria(input)
+		if err != nil {
+			t.Errorf("ParseSortCriteria(%q) returned unexpected error: %s", input, err)
+			continue
+		}
+		crit.Sort(objs)
+		for i, o := range objs {
+			if o.ID.String() != expected[i] {
+				t.Errorf("ParseSortCriteria(%q), expected %v, got %v at %d", input, expected[i], o.ID, i)
+			}
+		}
+	}
+
+	if _, err := ParseSortCriteria("+dc:creator"); err == nil {
+		t.Error("ParseSortCriteria should reject unsupported properties")
+	}
+}
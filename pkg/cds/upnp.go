@@ -4,16 +4,27 @@ import (
 	"context"
 	"encoding/xml"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/Adirelle/dms/pkg/didl_lite"
 	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/dms/pkg/renderer"
 	"github.com/Adirelle/dms/pkg/upnp"
 	adi_http "github.com/Adirelle/go-libs/http"
 	"github.com/Adirelle/go-libs/logging"
 )
 
 const (
-	NoSuchObjectErrorCode = 701
+	NoSuchObjectErrorCode          = 701
+	InvalidSearchCriteriaErrorCode = 708
+	InvalidSortCriteriaErrorCode   = 709
+	NoSuchContainerErrorCode       = 710
 
 	// Service identifier URN
 	ServiceID = "urn:upnp-org:serviceId:ContentDirectory"
@@ -26,27 +37,129 @@ const (
 type Service struct {
 	ContentDirectory
 	*upnp.Service
+	// SearchDirectory is walked by Search, e.g. the filesystem tree without the virtual containers, archives and playlists.
+	// The containers it does not provide, and all of them if it is nil, are searched through the ContentDirectory.
+	SearchDirectory ContentDirectory
+
+	lastUpdateID uint32
+	// containerUpdateIDs holds the update IDs of the modified containers, incremented on each change
+	containerUpdateIDs map[filesystem.ID]uint32
+	// changedContainers holds the containers changed since the last event, i.e. the value of the ContainerUpdateIDs variable
+	changedContainers map[filesystem.ID]bool
+	// sentAt is the time the changed containers have been sent, zero if some changes are pending
+	sentAt time.Time
+	mu     sync.Mutex
 }
 
 // New initializes a content-directory service
-func NewService(directory ContentDirectory) *Service {
-	s := &Service{
-		directory,
-		upnp.NewService(ServiceID, ServiceType),
+func NewService(directory ContentDirectory) (s *Service, err error) {
+	s = &Service{
+		ContentDirectory:   directory,
+		Service:            upnp.NewService(ServiceID, ServiceType),
+		containerUpdateIDs: make(map[filesystem.ID]uint32),
+		changedContainers:  make(map[filesystem.ID]bool),
 	}
 
-	s.AddActionFunc("Browse", s.Browse)
-	s.AddActionFunc("GetSystemUpdateID", s.GetSystemUpdateID)
-	s.AddActionFunc("GetSortCapabilities", s.GetSortCapabilities)
-	s.AddActionFunc("GetSearchCapabilities", s.GetSearchCapabilities)
+	actions := []struct {
+		name string
+		f    interface{}
+	}{
+		{"Browse", s.Browse},
+		{"GetSystemUpdateID", s.GetSystemUpdateID},
+		{"GetSortCapabilities", s.GetSortCapabilities},
+		{"GetSearchCapabilities", s.GetSearchCapabilities},
+		{"Search", s.Search},
+	}
+	for _, a := range actions {
+		if err = s.AddActionFunc(a.name, a.f); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.AddEventedVariable("SystemUpdateID", "ui4", func() string {
+		return strconv.FormatUint(uint64(s.updateID()), 10)
+	})
+	if err == nil {
+		err = s.AddEventedVariable("ContainerUpdateIDs", "string", s.sendContainerUpdateIDs)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return s
+	return s, nil
 }
 
 func (s *Service) updateID() uint32 {
 	return uint32(s.LastModTime().Unix())
 }
 
+// ContainersChanged notifies the subscribers that the given containers have been modified.
+// The changes are accumulated until they have been sent, as the events are moderated.
+func (s *Service) ContainersChanged(ids ...filesystem.ID) {
+	updateID := s.updateID()
+
+	s.mu.Lock()
+	// The subscribers are notified at most one moderation interval after a change,
+	// so they all have received the previous changes by then
+	if !s.sentAt.IsZero() && time.Since(s.sentAt) >= upnp.EventModerationInterval {
+		s.changedContainers = make(map[filesystem.ID]bool)
+	}
+	s.sentAt = time.Time{}
+	for _, id := range ids {
+		s.containerUpdateIDs[id]++
+		s.changedContainers[id] = true
+	}
+	s.lastUpdateID = updateID
+	s.mu.Unlock()
+
+	s.Notify("SystemUpdateID", "ContainerUpdateIDs")
+}
+
+// sendContainerUpdateIDs returns the value of the ContainerUpdateIDs variable, i.e. the changed containers
+// with their latest update IDs, and records that they have been sent.
+func (s *Service) sendContainerUpdateIDs() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.changedContainers))
+	for id := range s.changedContainers {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+	parts := make([]string, 0, 2*len(ids))
+	for _, id := range ids {
+		updateID := s.containerUpdateIDs[filesystem.ID(id)]
+		parts = append(parts, strings.Replace(id, ",", "\\,", -1), strconv.FormatUint(uint64(updateID), 10))
+	}
+	if s.sentAt.IsZero() {
+		s.sentAt = time.Now()
+	}
+	return strings.Join(parts, ",")
+}
+
+// ObjectsChanged notifies the subscribers that the given objects have been added, modified or removed.
+func (s *Service) ObjectsChanged(ids []filesystem.ID) {
+	seen := make(map[filesystem.ID]bool, len(ids))
+	parentIDs := make([]filesystem.ID, 0, len(ids))
+	for _, id := range ids {
+		if parentID := id.ParentID(); !parentID.IsNull() && !seen[parentID] {
+			seen[parentID] = true
+			parentIDs = append(parentIDs, parentID)
+		}
+	}
+	s.ContainersChanged(parentIDs...)
+}
+
+// checkUpdateID notifies the subscribers if the system update ID has changed since the last event.
+func (s *Service) checkUpdateID(updateID uint32) {
+	s.mu.Lock()
+	changed := updateID != s.lastUpdateID
+	s.lastUpdateID = updateID
+	s.mu.Unlock()
+	if changed {
+		s.Notify("SystemUpdateID")
+	}
+}
+
 type empty struct {
 	XMLName xml.Name
 }
@@ -68,7 +181,7 @@ type getSortCapabilitiesResponse struct {
 }
 
 func (s *Service) GetSortCapabilities(q empty, _ *http.Request) (getSortCapabilitiesResponse, error) {
-	return getSortCapabilitiesResponse{XMLNS: q.XMLName.Space, SortCaps: "dc:title"}, nil
+	return getSortCapabilitiesResponse{XMLNS: q.XMLName.Space, SortCaps: SortCapabilities}, nil
 }
 
 type getSearchCapabilitiesResponse struct {
@@ -78,7 +191,7 @@ type getSearchCapabilitiesResponse struct {
 }
 
 func (s *Service) GetSearchCapabilities(q empty, _ *http.Request) (getSearchCapabilitiesResponse, error) {
-	return getSearchCapabilitiesResponse{XMLNS: q.XMLName.Space, SearchCaps: ""}, nil
+	return getSearchCapabilitiesResponse{XMLNS: q.XMLName.Space, SearchCaps: propertyNames(properties)}, nil
 }
 
 type browseQuery struct {
@@ -108,27 +221,42 @@ func (s *Service) Browse(q browseQuery, req *http.Request) (r browseReply, err e
 	if err != nil {
 		return
 	}
+	r.Result, err = s.marshalResult(objs, didl_lite.ParseFilter(q.Filter), ctx)
+	if err != nil {
+		return
+	}
+	r.NumberReturned = uint32(len(objs))
+	r.XMLNS = q.XMLName.Space
+	r.UpdateID = s.updateID()
+	s.checkUpdateID(r.UpdateID)
+	return
+}
+
+func (s *Service) marshalResult(objs []*Object, filter didl_lite.Filter, ctx context.Context) ([]byte, error) {
 	urlGen := adi_http.URLGeneratorFromContext(ctx)
+	prf := renderer.FromContext(ctx)
 	result := didl_lite.DIDLLite{}
 	for _, o := range objs {
-		if didl_obj, err := o.MarshalDIDLLite(urlGen); err == nil {
+		if didl_obj, err := o.MarshalDIDLLite(urlGen, filter); err == nil {
+			prf.RewriteDIDLLite(didl_obj)
 			result.AddObjects(didl_obj)
 		} else {
-			logging.MustFromContext(req.Context()).Warn(err)
+			logging.MustFromContext(ctx).Warn(err)
 		}
 	}
-	r.Result, err = xml.Marshal(result)
-	if err != nil {
-		return
+	return xml.Marshal(result)
+}
+
+func (s *Service) doBrowse(q browseQuery, ctx context.Context) (objs []*Object, total uint32, err error) {
+	objs, total, err = s.doBrowseObject(q, ctx)
+	if isNotExist(err) {
+		err = upnp.Errorf(NoSuchObjectErrorCode, "no such object: %q", q.ObjectID)
 	}
-	r.NumberReturned = uint32(len(objs))
-	r.XMLNS = q.XMLName.Space
-	r.UpdateID = s.updateID()
 	return
 }
 
-func (s *Service) doBrowse(q browseQuery, ctx context.Context) ([]*Object, uint32, error) {
-	id, err := filesystem.ParseObjectID(q.ObjectID)
+func (s *Service) doBrowseObject(q browseQuery, ctx context.Context) ([]*Object, uint32, error) {
+	id, err := filesystem.ParseObjectID(renderer.FromContext(ctx).ContainerID(q.ObjectID))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -136,7 +264,11 @@ func (s *Service) doBrowse(q browseQuery, ctx context.Context) ([]*Object, uint3
 	case "BrowseMetadata":
 		return s.doBrowseMetadata(id, ctx)
 	case "BrowseDirectChildren":
-		return s.doBrowseDirectChildren(id, q.StartingIndex, q.RequestedCount, ctx)
+		sortCrit, err := parseSortCriteria(q.SortCriteria)
+		if err != nil {
+			return nil, 0, err
+		}
+		return s.doBrowseDirectChildren(id, q.StartingIndex, q.RequestedCount, sortCrit, ctx)
 	}
 	return nil, 0, upnp.Errorf(upnp.ArgumentValueInvalidErrorCode, "unhandled BrowseFlag: %q", q.BrowseFlag)
 }
@@ -149,19 +281,135 @@ func (s *Service) doBrowseMetadata(id filesystem.ID, ctx context.Context) (objs
 	return []*Object{obj}, 1, nil
 }
 
-func (s *Service) doBrowseDirectChildren(id filesystem.ID, start uint32, limit uint32, ctx context.Context) (objs []*Object, total uint32, err error) {
+func (s *Service) doBrowseDirectChildren(id filesystem.ID, start uint32, limit uint32, sortCrit SortCriteria, ctx context.Context) (objs []*Object, total uint32, err error) {
 	objs, err = s.GetChildren(id, ctx)
 	if err != nil {
 		return
 	}
-	total = uint32(len(objs))
+	sortCrit.Sort(objs)
+	objs, total = paginate(objs, start, limit)
+	return
+}
+
+// isNotExist returns true if err means that the requested object does not exist,
+// including when its identifier is invalid or one of its ancestors is not a directory.
+func isNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+	if os.IsNotExist(err) || err == filesystem.ErrInvalidObjectID {
+		return true
+	}
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.ENOTDIR
+}
+
+func parseSortCriteria(s string) (crit SortCriteria, err error) {
+	crit, err = ParseSortCriteria(s)
+	if err != nil {
+		err = upnp.Errorf(InvalidSortCriteriaErrorCode, "%s", err)
+	}
+	return
+}
+
+// paginate returns the requested slice of objs and the total number of objects.
+// A limit of 0 means no limit.
+func paginate(objs []*Object, start uint32, limit uint32) ([]*Object, uint32) {
+	total := uint32(len(objs))
 	if start > total {
 		start = total
 	}
 	end := start + limit
 	if limit == 0 || end > total {
-		end = total - start
+		end = total
+	}
+	return objs[start:end], total
+}
+
+type searchQuery struct {
+	XMLName        xml.Name
+	ContainerID    string `statevar:"A_ARG_TYPE_ObjectID"`
+	SearchCriteria string `statevar:"A_ARG_TYPE_SearchCriteria"`
+	Filter         string `statevar:"A_ARG_TYPE_Filter"`
+	StartingIndex  uint32 `statevar:"A_ARG_TYPE_Index"`
+	RequestedCount uint32 `statevar:"A_ARG_TYPE_Count"`
+	SortCriteria   string `statevar:"A_ARG_TYPE_SortCriteria"`
+}
+
+type searchReply struct {
+	XMLName        xml.Name `xml:"u:SearchResponse"`
+	XMLNS          string   `xml:"xmlns:u,attr"`
+	Result         []byte   `statevar:"A_ARG_TYPE_Result,string"`
+	NumberReturned uint32   `statevar:"A_ARG_TYPE_Count"`
+	TotalMatches   uint32   `statevar:"A_ARG_TYPE_Count"`
+	UpdateID       uint32   `statevar:"A_ARG_TYPE_UpdateID"`
+}
+
+func (s *Service) Search(q searchQuery, req *http.Request) (r searchReply, err error) {
+	ctx, cFunc := context.WithCancel(req.Context())
+	defer cFunc()
+	var objs []*Object
+	objs, r.TotalMatches, err = s.doSearch(q, ctx)
+	if err != nil {
+		return
+	}
+	r.Result, err = s.marshalResult(objs, didl_lite.ParseFilter(q.Filter), ctx)
+	if err != nil {
+		return
+	}
+	r.NumberReturned = uint32(len(objs))
+	r.XMLNS = q.XMLName.Space
+	r.UpdateID = s.updateID()
+	s.checkUpdateID(r.UpdateID)
+	return
+}
+
+func (s *Service) doSearch(q searchQuery, ctx context.Context) (objs []*Object, total uint32, err error) {
+	crit, err := ParseSearchCriteria(q.SearchCriteria)
+	if err != nil {
+		err = upnp.Errorf(InvalidSearchCriteriaErrorCode, "%s", err)
+		return
+	}
+	sortCrit, err := parseSortCriteria(q.SortCriteria)
+	if err != nil {
+		return
+	}
+	id, err := filesystem.ParseObjectID(renderer.FromContext(ctx).ContainerID(q.ContainerID))
+	var container *Object
+	if err == nil {
+		container, err = s.Get(id, ctx)
+	}
+	if isNotExist(err) || (err == nil && !container.IsContainer()) {
+		err = upnp.Errorf(NoSuchContainerErrorCode, "no such container: %q", q.ContainerID)
+	}
+	if err != nil {
+		return
+	}
+	var d ContentDirectory = s
+	if s.SearchDirectory != nil {
+		if _, err := s.SearchDirectory.Get(id, ctx); err == nil {
+			d = s.SearchDirectory
+		}
+	}
+	// The same item can appear in several containers
+	seen := make(map[filesystem.ID]bool)
+	err = Walk(d, id, ctx, func(o *Object) error {
+		if o.IsContainer() && strings.HasPrefix(o.ID.BaseName(), ".") {
+			// Virtual containers, e.g. the music views
+			return SkipContainer
+		}
+		if !seen[o.ID] && crit.Match(o) {
+			seen[o.ID] = true
+			objs = append(objs, o)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return
 	}
-	objs = objs[start:end]
+	sortCrit.Sort(objs)
+	objs, total = paginate(objs, q.StartingIndex, q.RequestedCount)
 	return
 }
@@ -0,0 +1,148 @@
+package cds
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/dms/pkg/upnp"
+)
+
+func TestUnknownObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dms-cds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := filesystem.New(filesystem.Config{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewService(&FilesystemContentDirectory{fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, id := range []string{"/missing", "/a.mp3/child", "invalid"} {
+		_, _, err := s.doBrowse(browseQuery{ObjectID: id, BrowseFlag: "BrowseMetadata"}, ctx)
+		if e, ok := err.(*upnp.Error); !ok || e.Code != NoSuchObjectErrorCode {
+			t.Errorf("Browse(%q), expected error %d, got %v", id, NoSuchObjectErrorCode, err)
+		}
+	}
+	for _, id := range []string{"/missing", "/a.mp3/child", "invalid", "/a.mp3"} {
+		_, _, err := s.doSearch(searchQuery{ContainerID: id, SearchCriteria: "*"}, ctx)
+		if e, ok := err.(*upnp.Error); !ok || e.Code != NoSuchContainerErrorCode {
+			t.Errorf("Search(%q), expected error %d, got %v", id, NoSuchContainerErrorCode, err)
+		}
+	}
+}
+
+// treeDirectory is an in-memory ContentDirectory, recording the listed containers
+type treeDirectory struct {
+	children map[filesystem.ID][]filesystem.ID
+	listed   []filesystem.ID
+}
+
+func (d *treeDirectory) Get(id filesystem.ID, _ context.Context) (*Object, error) {
+	_, isDir := d.children[id]
+	if !isDir && d.children[id.ParentID()] == nil {
+		return nil, os.ErrNotExist
+	}
+	return &Object{Object: filesystem.Object{ID: id, Name: id.BaseName(), IsDir: isDir}}, nil
+}
+
+func (d *treeDirectory) GetChildren(id filesystem.ID, ctx context.Context) ([]*Object, error) {
+	d.listed = append(d.listed, id)
+	var children []*Object
+	for _, childID := range d.children[id] {
+		child, _ := d.Get(childID, ctx)
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+func (d *treeDirectory) LastModTime() time.Time { return time.Time{} }
+
+// unlistableDirectory fails to list its containers
+type unlistableDirectory struct {
+	ContentDirectory
+}
+
+func (unlistableDirectory) GetChildren(filesystem.ID, context.Context) ([]*Object, error) {
+	return nil, errors.New("not listable")
+}
+
+func TestSearchWalk(t *testing.T) {
+	d := &treeDirectory{children: map[filesystem.ID][]filesystem.ID{
+		"/":       {"/a.mp3", "/.music", "/loop"},
+		"/.music": {"/.music/a.mp3"},
+		// Contains itself
+		"/loop": {"/loop", "/loop/b.mp3"},
+	}}
+	search := func(s *Service) (ids []string) {
+		objs, _, err := s.doSearch(searchQuery{ContainerID: "0", SearchCriteria: "*"}, context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, o := range objs {
+			ids = append(ids, o.ID.String())
+		}
+		sort.Strings(ids)
+		return
+	}
+
+	s, err := NewService(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/a.mp3", "/loop", "/loop/b.mp3"}
+	if actual := search(s); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if expected := []filesystem.ID{"/", "/loop"}; !reflect.DeepEqual(d.listed, expected) {
+		t.Errorf("expected the containers %v to be listed once, got %v", expected, d.listed)
+	}
+
+	// The search directory is walked instead of the full one
+	if s, err = NewService(unlistableDirectory{d}); err != nil {
+		t.Fatal(err)
+	}
+	s.SearchDirectory = d
+	if actual := search(s); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestContainerUpdateIDs(t *testing.T) {
+	s, err := NewService(&treeDirectory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both changes happen before the moderated event is sent
+	s.ContainersChanged("/a")
+	s.ContainersChanged("/b")
+	if actual, expected := s.sendContainerUpdateIDs(), "/a,1,/b,1"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	// The other subscribers may not have been notified yet
+	s.ContainersChanged("/a")
+	if actual, expected := s.sendContainerUpdateIDs(), "/a,2,/b,1"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	s.sentAt = time.Now().Add(-upnp.EventModerationInterval)
+	s.ContainersChanged("/c,d")
+	if actual, expected := s.sendContainerUpdateIDs(), `/c\,d,1`; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,36 @@
+package didl_lite
+
+import "strings"
+
+// Filter selects the optional properties to output, as defined by the Filter argument of Browse and Search.
+// A nil Filter selects all properties.
+type Filter map[string]bool
+
+// AllProperties is the Filter that selects every property
+var AllProperties Filter
+
+// ParseFilter parses a comma-separated list of property names.
+// "*" selects all properties, while the empty string selects only the required ones.
+// Attribute names, e.g. "res@size", also select the element they belong to.
+func ParseFilter(s string) Filter {
+	f := Filter{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "*":
+			return AllProperties
+		case name == "":
+			continue
+		}
+		f[name] = true
+		if i := strings.IndexByte(name, '@'); i > 0 {
+			f[name[:i]] = true
+		}
+	}
+	return f
+}
+
+// Includes returns true if the property should be output
+func (f Filter) Includes(name string) bool {
+	return f == nil || f[name]
+}
@@ -0,0 +1,24 @@
+package didl_lite
+
+import "testing"
+
+func TestParseFilter(t *testing.T) {
+	var data = map[string]map[string]bool{
+		"*":                                {"dc:date": true, "res": true, "res@size": true},
+		"":                                 {"dc:date": false, "res": false, "res@size": false},
+		" , ":                              {"dc:date": false, "res": false},
+		"dc:date,res@duration":             {"dc:date": true, "res": true, "res@duration": true, "res@size": false, "upnp:artist": false},
+		" upnp:albumArtURI , @childCount ": {"upnp:albumArtURI": true, "@childCount": true, "res": false},
+	}
+	if f := ParseFilter(""); f == nil || len(f) != 0 {
+		t.Errorf("ParseFilter(\"\"), expected an empty filter, got %v", f)
+	}
+	for input, expected := range data {
+		f := ParseFilter(input)
+		for name, included := range expected {
+			if actual := f.Includes(name); actual != included {
+				t.Errorf("ParseFilter(%q).Includes(%q), expected %v, got %v", input, name, included, actual)
+			}
+		}
+	}
+}
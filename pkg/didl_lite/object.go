@@ -2,6 +2,8 @@ package didl_lite
 
 import (
 	"encoding/xml"
+	"sort"
+	"strings"
 )
 
 // See http://upnp.org/schemas/av/didl-lite-v3.xsd for reference
@@ -32,6 +34,11 @@ const (
 	TagTOC                  = "upnp:toc"
 	TagContainerUpdateID    = "upnp:containerUpdateID"
 	TagObjectUpdateID       = "upnp:objectUpdateID"
+	TagResource             = "res"
+	TagCaptionInfoEx        = "sec:CaptionInfoEx"
+
+	AttrChildCount = "@childCount"
+	AttrProfileID  = "dlna:profileID"
 )
 
 // Object is either an Item or a Container
@@ -55,6 +62,15 @@ type Common struct {
 
 	// Related resources
 	Resources []Resource `xml:"res" json:",omitempty"`
+
+	// Subtitles, as expected by Samsung devices
+	Captions []CaptionInfo `xml:"sec:CaptionInfoEx" json:",omitempty"`
+}
+
+// CaptionInfo points to a subtitle file
+type CaptionInfo struct {
+	Type string `xml:"sec:type,attr" json:"type"`
+	URI  string `xml:",chardata" json:"uri"`
 }
 
 func (c *Common) marker() {}
@@ -63,6 +79,7 @@ func (c *Common) AddResources(r ...Resource) {
 	c.Resources = append(c.Resources, r...)
 }
 
+// tagElements holds the optional elements. The attributes of an element are stored as "element@attribute".
 type tagElements map[string]string
 
 func (b *tagElements) Set(name, value string) {
@@ -72,14 +89,33 @@ func (b *tagElements) Set(name, value string) {
 	(*b)[name] = value
 }
 
+// Delete removes an element with its attributes
+func (b *tagElements) Delete(name string) {
+	for key := range *b {
+		if key == name || strings.HasPrefix(key, name+"@") {
+			delete(*b, key)
+		}
+	}
+}
+
 func (b *tagElements) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
 	if *b == nil {
 		return nil
 	}
-	for name, value := range *b {
+	names := make([]string, 0, len(*b))
+	attrs := make(map[string][]xml.Attr)
+	for key, value := range *b {
+		if i := strings.IndexByte(key, '@'); i > 0 {
+			attrs[key[:i]] = append(attrs[key[:i]], xml.Attr{Name: xml.Name{Local: key[i+1:]}, Value: value})
+		} else {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
 		if err := e.EncodeElement(
-			xml.CharData(value),
-			xml.StartElement{Name: xml.Name{Local: name}},
+			xml.CharData((*b)[name]),
+			xml.StartElement{Name: xml.Name{Local: name}, Attr: attrs[name]},
 		); err != nil {
 			return err
 		}
@@ -110,6 +146,8 @@ func (Container) IsContainer() bool {
 // Item is a group of related resources
 type Item struct {
 	XMLName xml.Name `xml:"item" json:"-"`
+	// RefID is the ID of the item this one refers to
+	RefID string `xml:"refID,attr,omitempty" json:",omitempty"`
 	Common
 }
 
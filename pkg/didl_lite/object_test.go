@@ -0,0 +1,28 @@
+package didl_lite
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestTagElementsMarshalXML(t *testing.T) {
+	item := &Item{Common: Common{ID: "/a", ParentID: "/", Title: "A", Class: "object.item"}}
+	item.Tags.Set(TagArtist, "Artist")
+	item.Tags.Set(TagAlbumArtURI, "http://host/thumb")
+	item.Tags.Set(TagAlbumArtURI+"@"+AttrProfileID, "JPEG_TN")
+
+	out, err := xml.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<item id="/a" parentID="/" restricted="false"><dc:title>A</dc:title><upnp:class>object.item</upnp:class>` +
+		`<upnp:albumArtURI dlna:profileID="JPEG_TN">http://host/thumb</upnp:albumArtURI><upnp:artist>Artist</upnp:artist></item>`
+	if actual := string(out); actual != expected {
+		t.Errorf("xml.Marshal(item), expected %s, got %s", expected, actual)
+	}
+
+	item.Tags.Delete(TagAlbumArtURI)
+	if len(item.Tags) != 1 {
+		t.Errorf("Delete(%q) should also remove the attributes, got %v", TagAlbumArtURI, item.Tags)
+	}
+}
@@ -33,6 +33,17 @@ func (r *Resource) SetTag(name, value string) {
 	r.tags[name] = value
 }
 
+func (r *Resource) DeleteTag(name string) {
+	delete(r.tags, name)
+}
+
+// SetFilteredTag sets the attribute only if it is selected by the filter
+func (r *Resource) SetFilteredTag(filter Filter, name, value string) {
+	if filter.Includes(TagResource + "@" + name) {
+		r.SetTag(name, value)
+	}
+}
+
 func (r *Resource) Tags() map[string]string {
 	return r.tags
 }
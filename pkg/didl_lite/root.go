@@ -14,6 +14,8 @@ var nsPrefixes = []xml.Attr{
 	xml.Attr{xml.Name{Local: "xmlns:av"}, "urn:schemas-upnp-org:av:av"},
 	xml.Attr{xml.Name{Local: "xmlns:dc"}, "http://purl.org/dc/elements/1.1/"},
 	xml.Attr{xml.Name{Local: "xmlns:upnp"}, "urn:schemas-upnp-org:metadata-1-0/upnp/"},
+	xml.Attr{xml.Name{Local: "xmlns:sec"}, "http://www.sec.co.kr/"},
+	xml.Attr{xml.Name{Local: "xmlns:dlna"}, "urn:schemas-dlna-org:metadata-1-0/"},
 }
 
 func (d *DIDLLite) AddObjects(o ...Object) {
@@ -3,6 +3,8 @@ package didl_lite
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -32,3 +34,30 @@ func (d Duration) String() string {
 func (d Duration) MarshalText() (text []byte, err error) {
 	return []byte(d.String()), nil
 }
+
+// ParseDuration parses durations in the H+:MM:SS[.F+] format used by DIDL-Lite.
+func ParseDuration(s string) (d Duration, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		err = fmt.Errorf("invalid duration: %q", s)
+		return
+	}
+	h, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return
+	}
+	m, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return
+	}
+	sec, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return
+	}
+	if m > 59 || sec < 0 || sec >= 60 {
+		err = fmt.Errorf("invalid duration: %q", s)
+		return
+	}
+	td := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second))
+	return Duration(td), nil
+}
@@ -0,0 +1,47 @@
+package dlna
+
+import "fmt"
+
+// Values of the DLNA.ORG_OP parameter of the protocolInfo, which tells the seek modes supported by the server
+const (
+	OpNone      = "00"
+	OpByteSeek  = "01"
+	OpTimeSeek  = "10"
+	OpBothSeeks = "11"
+)
+
+// Flags are the primary flags of the DLNA.ORG_FLAGS parameter
+type Flags uint32
+
+const (
+	SenderPacedFlag Flags = 1 << (31 - iota)
+	TimeBasedSeekFlag
+	ByteBasedSeekFlag
+	PlayContainerFlag
+	S0IncreasingFlag
+	SNIncreasingFlag
+	RTSPPauseFlag
+	StreamingTransferModeFlag
+	InteractiveTransferModeFlag
+	BackgroundTransferModeFlag
+	ConnectionStallingFlag
+	DLNAV15Flag
+)
+
+const (
+	// StreamingFlags are used for audio and video content
+	StreamingFlags = StreamingTransferModeFlag | BackgroundTransferModeFlag | ConnectionStallingFlag | DLNAV15Flag
+	// InteractiveFlags are used for images
+	InteractiveFlags = InteractiveTransferModeFlag | BackgroundTransferModeFlag | ConnectionStallingFlag | DLNAV15Flag
+)
+
+// String formats the flags as the 32 hexadecimal digits of DLNA.ORG_FLAGS, the reserved ones being zero
+func (f Flags) String() string {
+	return fmt.Sprintf("%08X%024X", uint32(f), 0)
+}
+
+// Values of the DLNA.ORG_CI parameter
+const (
+	NotConverted = "0"
+	Converted    = "1"
+)
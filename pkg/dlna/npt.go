@@ -0,0 +1,124 @@
+package dlna
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TimeSeekRangeHeader is used by renderers to request a time range, and by servers to describe the served range
+	TimeSeekRangeHeader = "TimeSeekRange.dlna.org"
+	// TransferModeHeader indicates how the content is transferred
+	TransferModeHeader = "transferMode.dlna.org"
+)
+
+// ErrInvalidRange is returned for malformed or unsatisfiable NPT ranges
+var ErrInvalidRange = errors.New("invalid NPT range")
+
+// NPTRange is a range expressed in Normal Play Time, as used in TimeSeekRange.dlna.org headers.
+// A zero End means "up to the end".
+type NPTRange struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseNPTRange parses a range like "npt=10.5-", "npt=0:01:00-0:02:30.5" or "npt=10-20/3600".
+// The optional instance duration is ignored.
+func ParseNPTRange(s string) (r NPTRange, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "npt=") {
+		err = ErrInvalidRange
+		return
+	}
+	s = strings.TrimPrefix(s, "npt=")
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		err = ErrInvalidRange
+		return
+	}
+	if r.Start, err = ParseNPTTime(parts[0]); err != nil {
+		return
+	}
+	if parts[1] != "" {
+		if r.End, err = ParseNPTTime(parts[1]); err != nil {
+			return
+		}
+		if r.End <= r.Start {
+			err = ErrInvalidRange
+		}
+	}
+	return
+}
+
+// ParseNPTTime parses a NPT time, either in seconds ("123.45") or as H+:MM:SS[.F+].
+func ParseNPTTime(s string) (d time.Duration, err error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ":")
+	var h, m uint64
+	switch len(parts) {
+	case 1:
+	case 3:
+		if h, err = strconv.ParseUint(parts[0], 10, 32); err != nil {
+			return 0, ErrInvalidRange
+		}
+		if m, err = strconv.ParseUint(parts[1], 10, 8); err != nil || m > 59 {
+			return 0, ErrInvalidRange
+		}
+	default:
+		return 0, ErrInvalidRange
+	}
+	sec, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || sec < 0 || (len(parts) == 3 && sec >= 60) {
+		return 0, ErrInvalidRange
+	}
+	d = time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second))
+	return
+}
+
+// FormatNPTTime formats a duration as H+:MM:SS.mmm
+func FormatNPTTime(d time.Duration) string {
+	ms := d / time.Millisecond
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, (ms/60000)%60, (ms/1000)%60, ms%1000)
+}
+
+// Resolve checks the range against the total duration of the media and fills in End.
+// A zero total means the duration is unknown.
+func (r NPTRange) Resolve(total time.Duration) (NPTRange, error) {
+	if total == 0 {
+		return r, nil
+	}
+	if r.Start >= total {
+		return r, ErrInvalidRange
+	}
+	if r.End == 0 || r.End > total {
+		r.End = total
+	}
+	return r, nil
+}
+
+// Duration returns the length of the range, zero if it is open-ended.
+func (r NPTRange) Duration() time.Duration {
+	if r.End == 0 {
+		return 0
+	}
+	return r.End - r.Start
+}
+
+// Header formats the range for the TimeSeekRange.dlna.org response header.
+// A zero total is written as "*".
+func (r NPTRange) Header(total time.Duration) string {
+	end, instance := "", "*"
+	if r.End != 0 {
+		end = FormatNPTTime(r.End)
+	}
+	if total != 0 {
+		instance = FormatNPTTime(total)
+	}
+	return fmt.Sprintf("npt=%s-%s/%s", FormatNPTTime(r.Start), end, instance)
+}
@@ -0,0 +1,43 @@
+package dlna
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNPTRange(t *testing.T) {
+	var data = map[string]NPTRange{
+		"npt=0-":                     {0, 0},
+		"npt=10.5-":                  {10500 * time.Millisecond, 0},
+		"npt=0:01:00-0:02:30.5":      {time.Minute, 150500 * time.Millisecond},
+		"npt=10-20/3600":             {10 * time.Second, 20 * time.Second},
+		" npt=1:00:00.000-":          {time.Hour, 0},
+		"npt=00:00:05.000-00:00:10 ": {5 * time.Second, 10 * time.Second},
+	}
+	for input, expected := range data {
+		actual, err := ParseNPTRange(input)
+		if err != nil {
+			t.Errorf("ParseNPTRange(%q) returned unexpected error: %s", input, err)
+		} else if actual != expected {
+			t.Errorf("ParseNPTRange(%q), expected %v, got %v", input, expected, actual)
+		}
+	}
+
+	for _, input := range []string{"", "bytes=0-", "npt=", "npt=-10", "npt=20-10", "npt=0:60:00-", "npt=1:2-", "npt=a-"} {
+		if _, err := ParseNPTRange(input); err == nil {
+			t.Errorf("ParseNPTRange(%q) should have failed", input)
+		}
+	}
+}
+
+func TestNPTRangeHeader(t *testing.T) {
+	var data = map[string]string{
+		NPTRange{10 * time.Second, 0}.Header(0):                                   "npt=0:00:10.000-/*",
+		NPTRange{time.Minute, 2 * time.Minute}.Header(3661500 * time.Millisecond): "npt=0:01:00.000-0:02:00.000/1:01:01.500",
+	}
+	for actual, expected := range data {
+		if actual != expected {
+			t.Errorf("Header(), expected %q, got %q", expected, actual)
+		}
+	}
+}
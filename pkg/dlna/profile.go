@@ -0,0 +1,149 @@
+package dlna
+
+import "strings"
+
+// MediaInfo describes the media properties used to select a DLNA profile
+type MediaInfo struct {
+	// Container is the format name reported by ffprobe, e.g. "mov,mp4,m4a,3gp,3g2,mj2" or "mpegts"
+	Container  string
+	VideoCodec string
+	AudioCodec string
+	Width      uint
+	Height     uint
+	// Bitrate in bits per second
+	Bitrate    uint32
+	SampleRate uint32
+	Channels   uint
+}
+
+// ProfileName returns the DLNA profile name (DLNA.ORG_PN) matching the media, or an empty string if none does.
+// Only the most common profiles are recognized.
+func (m MediaInfo) ProfileName() string {
+	switch {
+	case m.isImage():
+		return m.imageProfile()
+	case m.VideoCodec != "":
+		return m.videoProfile()
+	case m.AudioCodec != "":
+		return m.audioProfile()
+	}
+	return ""
+}
+
+func (m MediaInfo) isImage() bool {
+	return m.AudioCodec == "" && (m.hasContainer("image2") || strings.HasSuffix(m.Container, "_pipe") || m.hasContainer("gif"))
+}
+
+func (m MediaInfo) hasContainer(name string) bool {
+	for _, c := range strings.Split(m.Container, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m MediaInfo) fits(width, height uint) bool {
+	return m.Width <= width && m.Height <= height
+}
+
+func (m MediaInfo) imageProfile() string {
+	switch m.VideoCodec {
+	case "mjpeg":
+		switch {
+		case m.fits(640, 480):
+			return "JPEG_SM"
+		case m.fits(1024, 768):
+			return "JPEG_MED"
+		case m.fits(4096, 4096):
+			return "JPEG_LRG"
+		}
+	case "png":
+		if m.fits(4096, 4096) {
+			return "PNG_LRG"
+		}
+	case "gif":
+		if m.fits(1600, 1200) {
+			return "GIF_LRG"
+		}
+	}
+	return ""
+}
+
+func (m MediaInfo) audioProfile() string {
+	switch m.AudioCodec {
+	case "mp3":
+		if m.hasContainer("mp3") {
+			if m.Bitrate <= 320000 && m.Channels <= 2 && (m.SampleRate == 32000 || m.SampleRate == 44100 || m.SampleRate == 48000) {
+				return "MP3"
+			}
+			return "MP3X"
+		}
+	case "aac":
+		suffix := ""
+		if m.Bitrate <= 320000 && m.Channels <= 2 && m.SampleRate <= 48000 {
+			suffix = "_320"
+		}
+		if m.hasContainer("mp4") {
+			return "AAC_ISO" + suffix
+		} else if m.hasContainer("aac") {
+			return "AAC_ADTS" + suffix
+		}
+	case "ac3":
+		return "AC3"
+	case "wmav2":
+		if m.hasContainer("asf") {
+			if m.Bitrate <= 192000 && m.SampleRate <= 48000 {
+				return "WMABASE"
+			}
+			return "WMAFULL"
+		}
+	case "pcm_s16be":
+		if m.Channels <= 2 {
+			return "LPCM"
+		}
+	}
+	return ""
+}
+
+func (m MediaInfo) videoProfile() string {
+	sd := m.fits(720, 576)
+	switch m.VideoCodec {
+	case "mpeg2video":
+		switch {
+		case m.hasContainer("mpegts") && sd:
+			return "MPEG_TS_SD_NA_ISO"
+		case m.hasContainer("mpegts"):
+			return "MPEG_TS_HD_NA_ISO"
+		case m.hasContainer("mpeg") && m.fits(720, 480):
+			return "MPEG_PS_NTSC"
+		case m.hasContainer("mpeg") && sd:
+			return "MPEG_PS_PAL"
+		}
+	case "h264":
+		size := "HD"
+		if sd {
+			size = "SD"
+		}
+		switch {
+		case m.hasContainer("mp4") && m.AudioCodec == "aac" && sd:
+			return "AVC_MP4_MP_SD_AAC_MULT5"
+		case m.hasContainer("mp4") && m.AudioCodec == "aac" && m.fits(1280, 720):
+			return "AVC_MP4_MP_HD_720p_AAC"
+		case m.hasContainer("mp4") && m.AudioCodec == "aac" && m.fits(1920, 1080):
+			return "AVC_MP4_MP_HD_1080i_AAC"
+		case m.hasContainer("mpegts") && m.AudioCodec == "aac" && m.fits(1920, 1080):
+			return "AVC_TS_MP_" + size + "_AAC_MULT5_ISO"
+		case m.hasContainer("mpegts") && m.AudioCodec == "ac3" && m.fits(1920, 1080):
+			return "AVC_TS_MP_" + size + "_AC3_ISO"
+		}
+	case "wmv3":
+		if m.hasContainer("asf") {
+			if sd {
+				return "WMVMED_FULL"
+			}
+			return "WMVHIGH_FULL"
+		}
+	}
+	return ""
+}
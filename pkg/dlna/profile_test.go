@@ -0,0 +1,30 @@
+package dlna
+
+import "testing"
+
+func TestProfileName(t *testing.T) {
+	var data = map[string]MediaInfo{
+		"JPEG_SM":                    {Container: "image2", VideoCodec: "mjpeg", Width: 640, Height: 480},
+		"JPEG_LRG":                   {Container: "image2", VideoCodec: "mjpeg", Width: 4000, Height: 3000},
+		"PNG_LRG":                    {Container: "png_pipe", VideoCodec: "png", Width: 800, Height: 600},
+		"MP3":                        {Container: "mp3", AudioCodec: "mp3", Bitrate: 192000, SampleRate: 44100, Channels: 2},
+		"MP3X":                       {Container: "mp3", AudioCodec: "mp3", Bitrate: 128000, SampleRate: 22050, Channels: 2},
+		"AAC_ISO_320":                {Container: "mov,mp4,m4a,3gp,3g2,mj2", AudioCodec: "aac", Bitrate: 256000, SampleRate: 44100, Channels: 2},
+		"AAC_ISO":                    {Container: "mov,mp4,m4a,3gp,3g2,mj2", AudioCodec: "aac", Bitrate: 384000, SampleRate: 48000, Channels: 6},
+		"AVC_MP4_MP_HD_720p_AAC":     {Container: "mov,mp4,m4a,3gp,3g2,mj2", VideoCodec: "h264", AudioCodec: "aac", Width: 1280, Height: 720},
+		"AVC_TS_MP_HD_AAC_MULT5_ISO": {Container: "mpegts", VideoCodec: "h264", AudioCodec: "aac", Width: 1920, Height: 1080},
+		"MPEG_PS_PAL":                {Container: "mpeg", VideoCodec: "mpeg2video", AudioCodec: "mp2", Width: 720, Height: 576},
+		"":                           {Container: "matroska,webm", VideoCodec: "h264", AudioCodec: "aac", Width: 1920, Height: 1080},
+	}
+	for expected, info := range data {
+		if actual := info.ProfileName(); actual != expected {
+			t.Errorf("%+v.ProfileName(), expected %q, got %q", info, expected, actual)
+		}
+	}
+}
+
+func TestFlagsString(t *testing.T) {
+	if actual := StreamingFlags.String(); actual != "01700000000000000000000000000000" {
+		t.Errorf("StreamingFlags.String(), expected %q, got %q", "01700000000000000000000000000000", actual)
+	}
+}
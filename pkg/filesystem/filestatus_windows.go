@@ -18,31 +18,31 @@ func isHiddenPath(path string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	ch := sf.Do(path, doTestHiddenPath)
-	return (<-ch).(bool), nil
+	hidden, err := (<-sf.Do(path, doTestHiddenPath)).Value()
+	if err != nil {
+		return false, err
+	}
+	return hidden.(bool), nil
 }
 
-func doTestHiddenPath(key interface{}) (res interface{}, ok bool) {
+func doTestHiddenPath(key interface{}) cache.Result {
 	path := (key.(string))
 	if path == filepath.VolumeName(path)+"\\" {
 		// Volumes always have the "SYSTEM" flag, so do not even test them
-		return false, true
+		return cache.NewResult(false, nil)
 	}
 	winPath, err := windows.UTF16PtrFromString(path)
 	if err != nil {
-		return
+		return cache.NewResult(nil, err)
 	}
 	attrs, err := windows.GetFileAttributes(winPath)
 	if err != nil {
-		return
+		return cache.NewResult(nil, err)
 	}
-	if attrs&hiddenAttributes == 0 {
-		res, err = isHiddenPath(filepath.Dir(path))
-		if err != nil {
-			return
-		}
+	if attrs&hiddenAttributes != 0 {
+		return cache.NewResult(true, nil)
 	}
-	return false, true
+	return cache.NewResult(isHiddenPath(filepath.Dir(path)))
 }
 
 func isReadablePath(path string) (bool, error) {
@@ -1,38 +1,161 @@
 package filesystem
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Config holds the configuration parameters
 type Config struct {
-	// Root of the filesystem, a.k.a. directory to serve
+	// Root of the filesystem, a.k.a. directory to serve. Ignored if Roots is not empty.
 	Root string `json:"path"`
+	// Roots lists the directories to serve
+	Roots []Root `json:"roots,omitempty"`
+	// Watch selects how changes are detected: "auto", "inotify", "poll" or "none"
+	Watch string `json:"watch"`
+	// PollInterval is the delay between two scans when polling
+	PollInterval time.Duration `json:"pollInterval"`
+}
+
+// Root is a named directory to serve.
+// When there are several roots, each one appears as a container named after it, under a virtual root.
+type Root struct {
+	// Name of the container, defaults to the base name of Path
+	Name string `json:"name"`
+	// Path of the directory
+	Path string `json:"path"`
 }
 
 // Filesystem is the main entry point
 type Filesystem struct {
-	root        string
+	roots       []Root
 	lastModTime time.Time
+	mu          sync.RWMutex
 }
 
 // New creates a new Filesystem based on the passed configuration
 func New(conf Config) (fs *Filesystem, err error) {
-	root, err := filepath.Abs(filepath.Clean(conf.Root))
-	if err == nil {
-		fs = &Filesystem{root: root}
+	roots := conf.Roots
+	if len(roots) == 0 {
+		roots = []Root{{Path: conf.Root}}
+	}
+	fs = &Filesystem{roots: make([]Root, 0, len(roots))}
+	names := make(map[string]bool, len(roots))
+	for _, r := range roots {
+		if r.Path, err = filepath.Abs(filepath.Clean(r.Path)); err != nil {
+			return nil, err
+		}
+		if r.Name == "" {
+			r.Name = filepath.Base(r.Path)
+		}
+		if r.Name == "." || r.Name == ".." || strings.ContainsAny(r.Name, `/\`) {
+			return nil, fmt.Errorf("invalid root name: %q", r.Name)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate root name: %q", r.Name)
+		}
+		names[r.Name] = true
+		fs.roots = append(fs.roots, r)
 	}
 	return
 }
 
+// Roots returns the served directories, with absolute paths
+func (fs *Filesystem) Roots() []Root {
+	return fs.roots
+}
+
+// hasVirtualRoot returns true if the root container is the virtual parent of several roots
+func (fs *Filesystem) hasVirtualRoot() bool {
+	return len(fs.roots) > 1
+}
+
 func (fs *Filesystem) LastModTime() time.Time {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	return fs.lastModTime
 }
 
+// Touch moves the last modification time forward, if t is after it.
+func (fs *Filesystem) Touch(t time.Time) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if t.After(fs.lastModTime) {
+		fs.lastModTime = t
+	}
+}
+
+// FilePath returns the path of the file identified by id.
+// It returns os.ErrNotExist for identifiers that do not map to a file, like the virtual root.
+func (fs *Filesystem) FilePath(id ID) (string, error) {
+	if !fs.hasVirtualRoot() {
+		return filepath.Join(fs.roots[0].Path, filepath.FromSlash(id.String())), nil
+	}
+	if id.IsNull() || id.IsRoot() {
+		return "", os.ErrNotExist
+	}
+	parts := strings.SplitN(strings.TrimPrefix(id.String(), "/"), "/", 2)
+	for _, r := range fs.roots {
+		if r.Name != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			return r.Path, nil
+		}
+		return filepath.Join(r.Path, filepath.FromSlash(parts[1])), nil
+	}
+	return "", os.ErrNotExist
+}
+
+// PathID returns the identifier of the file at the given path.
+// It returns false if the path is outside of the filesystem.
+func (fs *Filesystem) PathID(path string) (ID, bool) {
+	var best *Root
+	var bestRel string
+	for i, r := range fs.roots {
+		rel, err := filepath.Rel(r.Path, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if best == nil || len(r.Path) > len(best.Path) {
+			best, bestRel = &fs.roots[i], rel
+		}
+	}
+	if best == nil {
+		return NullID, false
+	}
+	id := RootID
+	if fs.hasVirtualRoot() {
+		id = id.ChildID(best.Name)
+	}
+	if bestRel != "." {
+		id = id.ChildID(filepath.ToSlash(bestRel))
+	}
+	return id, true
+}
+
+// Contains returns true if the file of the item is inside the filesystem.
+// Items without file, like the virtual root, are always contained.
+func (fs *Filesystem) Contains(item *FileItem) bool {
+	if item.FilePath == "" {
+		return true
+	}
+	_, ok := fs.PathID(item.FilePath)
+	return ok
+}
+
 func (fs *Filesystem) Get(id ID) (ret *Object, err error) {
-	fp := filepath.Join(fs.root, filepath.FromSlash(id.String()))
+	if id.IsRoot() && fs.hasVirtualRoot() {
+		return fs.virtualRoot(), nil
+	}
+	fp, err := fs.FilePath(id)
+	if err != nil {
+		return
+	}
 	accept, err := fs.filter(fp)
 	if err == nil && !accept {
 		err = os.ErrNotExist
@@ -43,9 +166,7 @@ func (fs *Filesystem) Get(id ID) (ret *Object, err error) {
 	if err != nil {
 		return
 	}
-	if fi.ModTime().After(fs.lastModTime) {
-		fs.lastModTime = fi.ModTime()
-	}
+	fs.Touch(fi.ModTime())
 	if !fi.IsDir() && !fi.Mode().IsRegular() {
 		return nil, os.ErrNotExist
 	}
@@ -56,12 +177,29 @@ func (fs *Filesystem) Get(id ID) (ret *Object, err error) {
 		Size:     fi.Size(),
 		IsDir:    fi.IsDir(),
 	}
+	if fs.hasVirtualRoot() && id.ParentID().IsRoot() {
+		ret.Name = id.BaseName()
+	}
 	if ret.IsDir {
 		ret.ChildrenID, err = fs.readChildren(id, fp)
 	}
 	return
 }
 
+// virtualRoot builds the container of the roots
+func (fs *Filesystem) virtualRoot() *Object {
+	obj := &Object{
+		ID:         RootID,
+		FileItem:   FileItem{ModTime: fs.LastModTime()},
+		IsDir:      true,
+		ChildrenID: make([]ID, len(fs.roots)),
+	}
+	for i, r := range fs.roots {
+		obj.ChildrenID[i] = RootID.ChildID(r.Name)
+	}
+	return obj
+}
+
 func (fs *Filesystem) readChildren(id ID, dir string) (ret []ID, err error) {
 	fh, err := os.Open(dir)
 	if err != nil {
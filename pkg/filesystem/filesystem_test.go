@@ -0,0 +1,60 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultipleRoots(t *testing.T) {
+	fs, err := New(Config{Roots: []Root{{Name: "music", Path: "/srv/music"}, {Path: "/mnt/videos"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths = map[ID]string{
+		ID("/music"):             "/srv/music",
+		ID("/music/foo/bar.mp3"): "/srv/music/foo/bar.mp3",
+		ID("/videos/movie.mkv"):  "/mnt/videos/movie.mkv",
+	}
+	for id, expected := range paths {
+		if actual, err := fs.FilePath(id); err != nil {
+			t.Errorf("FilePath(%v) returned unexpected error: %s", id, err)
+		} else if actual != filepath.FromSlash(expected) {
+			t.Errorf("FilePath(%v), expected %v, got %v", id, expected, actual)
+		}
+		if actual, ok := fs.PathID(filepath.FromSlash(expected)); !ok || actual != id {
+			t.Errorf("PathID(%v), expected %v, got %v", expected, id, actual)
+		}
+	}
+
+	for _, id := range []ID{RootID, ID("/photos/foo.jpg")} {
+		if _, err := fs.FilePath(id); err != os.ErrNotExist {
+			t.Errorf("FilePath(%v), expected os.ErrNotExist, got %v", id, err)
+		}
+	}
+
+	if _, ok := fs.PathID("/srv/other"); ok {
+		t.Errorf("PathID should reject paths outside of the roots")
+	}
+
+	root, err := fs.Get(RootID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.ChildrenID) != 2 || root.ChildrenID[0] != ID("/music") || root.ChildrenID[1] != ID("/videos") {
+		t.Errorf("unexpected root children: %v", root.ChildrenID)
+	}
+}
+
+func TestInvalidRoots(t *testing.T) {
+	var data = map[string][]Root{
+		"duplicate name": {{Name: "a", Path: "/srv/a"}, {Name: "a", Path: "/srv/b"}},
+		"invalid name":   {{Name: "a/b", Path: "/srv/a"}},
+	}
+	for desc, roots := range data {
+		if _, err := New(Config{Roots: roots}); err == nil {
+			t.Errorf("New should have failed with %s", desc)
+		}
+	}
+}
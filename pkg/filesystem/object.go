@@ -3,9 +3,13 @@ package filesystem
 import (
 	"encoding/gob"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
+// FreshnessCheckInterval is the minimum delay between two checks of the same FileItem
+const FreshnessCheckInterval = 10 * time.Second
+
 func init() {
 	gob.Register(Object{})
 	gob.Register(FileItem{})
@@ -28,8 +32,9 @@ type FileItem struct {
 	FilePath string
 	ModTime  time.Time
 
-	isFresh     bool
-	lastChecked time.Time
+	// Both fields are accessed atomically
+	stale       int32
+	lastChecked int64
 }
 
 func ItemFromPath(filePath string) (item FileItem, err error) {
@@ -41,14 +46,29 @@ func ItemFromPath(filePath string) (item FileItem, err error) {
 }
 
 func ItemFromInfo(filePath string, fi os.FileInfo) FileItem {
-	return FileItem{filePath, fi.ModTime(), true, time.Now()}
+	return FileItem{FilePath: filePath, ModTime: fi.ModTime(), lastChecked: time.Now().UnixNano()}
+}
+
+// Item returns the item itself, so the types embedding a FileItem can expose it
+func (i *FileItem) Item() *FileItem {
+	return i
 }
 
-func (i FileItem) IsFresh() bool {
-	if time.Since(i.lastChecked) > 10*time.Second {
-		i.lastChecked = time.Now()
-		fi, err := os.Stat(i.FilePath)
-		i.isFresh = err == nil && fi.ModTime().Equal(i.ModTime)
+// IsFresh checks that the file has not been modified since the item has been created.
+// The file is checked at most once every FreshnessCheckInterval.
+// Items without file, like the virtual root, are always fresh.
+func (i *FileItem) IsFresh() bool {
+	if i.FilePath == "" {
+		return true
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&i.lastChecked)
+	if now-last > int64(FreshnessCheckInterval) && atomic.CompareAndSwapInt64(&i.lastChecked, last, now) {
+		var stale int32
+		if fi, err := os.Stat(i.FilePath); err != nil || !fi.ModTime().Equal(i.ModTime) {
+			stale = 1
+		}
+		atomic.StoreInt32(&i.stale, stale)
 	}
-	return i.isFresh
+	return atomic.LoadInt32(&i.stale) == 0
 }
@@ -0,0 +1,206 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+const (
+	// WatchAuto uses the native watcher if available, falling back to polling
+	WatchAuto = "auto"
+	// WatchNative only uses the native watcher (inotify)
+	WatchNative = "inotify"
+	// WatchPoll periodically scans the filesystem
+	WatchPoll = "poll"
+	// WatchNone disables change detection
+	WatchNone = "none"
+
+	// DefaultPollInterval is the delay between two scans when polling
+	DefaultPollInterval = time.Minute
+
+	// watchDelay is used to group the changes before reporting them
+	watchDelay = time.Second
+)
+
+// ErrWatchUnsupported is returned when the native watcher is not available on this platform
+var ErrWatchUnsupported = errors.New("native filesystem watching is not supported")
+
+// ChangeFunc is called with the identifiers of the changed files and directories.
+type ChangeFunc func([]ID)
+
+// Watcher detects the changes in the filesystem and reports them to the registered ChangeFuncs.
+// It implements suture.Service.
+type Watcher struct {
+	fs       *Filesystem
+	mode     string
+	interval time.Duration
+	handlers []ChangeFunc
+	done     chan struct{}
+	stop     sync.Once
+	l        logging.Logger
+}
+
+// NewWatcher creates a Watcher for the given Filesystem
+func NewWatcher(fs *Filesystem, c Config, l logging.Logger) *Watcher {
+	w := &Watcher{fs: fs, mode: c.Watch, interval: c.PollInterval, done: make(chan struct{}), l: l}
+	if w.mode == "" {
+		w.mode = WatchAuto
+	}
+	if w.interval <= 0 {
+		w.interval = DefaultPollInterval
+	}
+	return w
+}
+
+func (w *Watcher) String() string {
+	return "filesystem.watcher"
+}
+
+// OnChange registers a ChangeFunc. It must be called before starting the Watcher.
+func (w *Watcher) OnChange(f ChangeFunc) {
+	w.handlers = append(w.handlers, f)
+}
+
+// Serve watches the filesystem until Stop is called
+func (w *Watcher) Serve() {
+	if w.mode == WatchNone {
+		<-w.done
+		return
+	}
+
+	paths := make(chan string, 100)
+	errs := make(chan rootError, len(w.fs.roots))
+
+	for _, r := range w.fs.roots {
+		if w.mode == WatchAuto || w.mode == WatchNative {
+			go func(root string) { errs <- rootError{root, watchNative(root, paths, w.done, w.l)} }(r.Path)
+		} else {
+			errs <- rootError{r.Path, ErrWatchUnsupported}
+		}
+	}
+
+	pending := make(map[ID]bool)
+	var flush <-chan time.Time
+	for {
+		select {
+		case path := <-paths:
+			if id, ok := w.fs.PathID(path); ok && !isHiddenChange(path) {
+				pending[id] = true
+				if flush == nil {
+					flush = time.After(watchDelay)
+				}
+			}
+		case <-flush:
+			w.report(pending)
+			pending = make(map[ID]bool)
+			flush = nil
+		case re := <-errs:
+			if re.err == nil {
+				break
+			}
+			if w.mode == WatchNative {
+				w.l.Errorf("cannot watch %s: %s", re.root, re.err)
+				break
+			}
+			if re.err != ErrWatchUnsupported {
+				w.l.Warnf("cannot watch %s: %s, falling back to polling", re.root, re.err)
+			}
+			w.l.Infof("polling %s every %s", re.root, w.interval)
+			go w.poll(re.root, paths)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+type rootError struct {
+	root string
+	err  error
+}
+
+// Stop stops the Watcher. It can be called before Serve, and several times.
+func (w *Watcher) Stop() {
+	w.stop.Do(func() { close(w.done) })
+}
+
+func (w *Watcher) report(pending map[ID]bool) {
+	ids := make([]ID, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	w.l.Debugf("changes: %v", ids)
+	w.fs.Touch(time.Now())
+	for _, h := range w.handlers {
+		h(ids)
+	}
+}
+
+func isHiddenChange(path string) bool {
+	hidden, err := isHiddenPath(path)
+	return err == nil && hidden
+}
+
+type pollEntry struct {
+	modTime time.Time
+	size    int64
+}
+
+// poll scans the root directory every interval and sends the paths of the modified, created or removed entries.
+func (w *Watcher) poll(root string, paths chan<- string) {
+	known := w.scan(root, nil, paths)
+	for {
+		select {
+		case <-time.After(w.interval):
+			known = w.scan(root, known, paths)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) scan(root string, known map[string]pollEntry, paths chan<- string) map[string]pollEntry {
+	current := make(map[string]pollEntry, len(known))
+	send := func(path string) bool {
+		if known == nil {
+			return true
+		}
+		select {
+		case paths <- path:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+	filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if isHiddenChange(path) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		entry := pollEntry{fi.ModTime(), fi.Size()}
+		current[path] = entry
+		if prev, found := known[path]; !found || !prev.modTime.Equal(entry.modTime) || prev.size != entry.size {
+			if !send(path) {
+				return errors.New("stopped")
+			}
+		}
+		return nil
+	})
+	for path := range known {
+		if _, found := current[path]; !found {
+			if !send(path) {
+				break
+			}
+		}
+	}
+	return current
+}
@@ -0,0 +1,105 @@
+//+build linux
+
+package filesystem
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/Adirelle/go-libs/logging"
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE | unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO | unix.IN_ATTRIB | unix.IN_DELETE_SELF
+
+// watchNative uses inotify to watch the directory tree under root.
+// It sends the path of each changed entry until done is closed.
+func watchNative(root string, paths chan<- string, done <-chan struct{}, l logging.Logger) (err error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return
+	}
+	defer unix.Close(fd)
+
+	watches := make(map[int]string)
+	addTree := func(dir string) {
+		filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.IsDir() {
+				return nil
+			}
+			if isHiddenChange(path) {
+				return filepath.SkipDir
+			}
+			wd, err := unix.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				l.Warnf("cannot watch %s: %s", path, err)
+				return nil
+			}
+			watches[wd] = path
+			return nil
+		})
+	}
+	addTree(root)
+	l.Infof("watching %d directories under %s", len(watches), root)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.PathMax))
+	pfds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+
+		if _, err = unix.Poll(pfds, 500); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return
+		}
+
+		n, err := unix.Read(fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(ev.Len)]
+			offset += unix.SizeofInotifyEvent + int(ev.Len)
+
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+				l.Warn("inotify queue overflow, reporting the whole tree as changed")
+				paths <- root
+				continue
+			}
+			dir, known := watches[int(ev.Wd)]
+			if !known {
+				continue
+			}
+			if ev.Mask&unix.IN_IGNORED != 0 {
+				delete(watches, int(ev.Wd))
+				continue
+			}
+
+			path := dir
+			if name := string(bytes.TrimRight(nameBytes, "\x00")); name != "" {
+				path = filepath.Join(dir, name)
+			}
+			if ev.Mask&unix.IN_ISDIR != 0 && ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				addTree(path)
+			}
+
+			select {
+			case paths <- path:
+			case <-done:
+				return nil
+			}
+		}
+	}
+}
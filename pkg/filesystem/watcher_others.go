@@ -0,0 +1,9 @@
+//+build !linux
+
+package filesystem
+
+import "github.com/Adirelle/go-libs/logging"
+
+func watchNative(root string, paths chan<- string, done <-chan struct{}, l logging.Logger) error {
+	return ErrWatchUnsupported
+}
@@ -0,0 +1,32 @@
+package filesystem
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestWatcherStop(t *testing.T) {
+	fs, err := New(Config{Root: os.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{WatchNone, WatchPoll} {
+		w := NewWatcher(fs, Config{Watch: mode}, logging.NewTesting(t))
+		// Stopping before serving must neither panic nor block Serve
+		w.Stop()
+		w.Stop()
+		done := make(chan struct{})
+		go func() {
+			w.Serve()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("%s: Serve did not return after Stop", mode)
+		}
+	}
+}
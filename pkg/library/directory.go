@@ -0,0 +1,310 @@
+package library
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+)
+
+// Identifiers of the virtual containers. Hidden files are never served, so they cannot clash with real files.
+const (
+	MusicID          = filesystem.ID("/.music")
+	RecentlyAddedID  = filesystem.ID("/.recently-added")
+	RecentlyPlayedID = filesystem.ID("/.recently-played")
+)
+
+const (
+	MusicArtistClass = "object.container.person.musicArtist"
+	MusicAlbumClass  = "object.container.album.musicAlbum"
+	MusicGenreClass  = "object.container.genre.musicGenre"
+)
+
+// view is a hierarchy of virtual containers, one level per field, the last one listing the tracks
+type view struct {
+	name   string
+	title  string
+	fields []Field
+}
+
+var views = []view{
+	{"artists", "Artists", []Field{ArtistField, AlbumField}},
+	{"albums", "Albums", []Field{AlbumField}},
+	{"genres", "Genres", []Field{GenreField}},
+	{"years", "Years", []Field{YearField}},
+}
+
+var fieldClasses = map[Field]string{
+	ArtistField: MusicArtistClass,
+	AlbumField:  MusicAlbumClass,
+	GenreField:  MusicGenreClass,
+}
+
+// Directory adds virtual containers to the root of a ContentDirectory:
+// the music views, grouping the tracks of the index by artist, album, genre and year,
+// and the lists of the recently added and recently played items.
+// The items listed in the virtual containers are references to the objects of the underlying ContentDirectory:
+// their IDs are children of the container, and their refID is the ID of the actual item.
+type Directory struct {
+	cds.ContentDirectory
+	Index *Index
+	// Music enables the music views
+	Music bool
+	// Recent is the number of items of the "Recently added" and "Recently played" containers, 0 to disable them.
+	Recent int
+}
+
+func (d *Directory) Get(id filesystem.ID, ctx context.Context) (*cds.Object, error) {
+	if id.IsRoot() {
+		return d.getRoot(ctx)
+	}
+	if d.Recent > 0 {
+		switch id {
+		case RecentlyAddedID:
+			return d.newContainer(id, "Recently added", "", refIDs(id, d.Index.RecentlyAdded(d.Recent))), nil
+		case RecentlyPlayedID:
+			return d.newContainer(id, "Recently played", "", refIDs(id, d.Index.RecentlyPlayed(d.Recent))), nil
+		}
+		switch id.ParentID() {
+		case RecentlyAddedID:
+			return d.getRecentReference(id, d.Index.RecentlyAdded(d.Recent), ctx)
+		case RecentlyPlayedID:
+			return d.getRecentReference(id, d.Index.RecentlyPlayed(d.Recent), ctx)
+		}
+	}
+	v, values, ok := d.parseID(id)
+	if !ok {
+		return d.ContentDirectory.Get(id, ctx)
+	}
+	if v == nil {
+		return d.newContainer(MusicID, "Music", "", d.viewIDs()), nil
+	}
+	if len(values) > len(v.fields)+1 {
+		return nil, os.ErrNotExist
+	}
+
+	filter := make(Filter, len(values))
+	for i, value := range values {
+		if i == len(v.fields) {
+			return d.getTrackReference(id, filesystem.ID(value), filter, ctx)
+		}
+		filter[v.fields[i]] = value
+	}
+
+	var childrenID []filesystem.ID
+	if len(values) < len(v.fields) {
+		for _, value := range d.Index.Values(v.fields[len(values)], filter) {
+			childrenID = append(childrenID, id.ChildID(escape(value)))
+		}
+	} else {
+		for _, t := range d.Index.Tracks(filter) {
+			childrenID = append(childrenID, refID(id, t.ID))
+		}
+	}
+	if len(values) > 0 && len(childrenID) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	if len(values) == 0 {
+		return d.newContainer(id, v.title, "", childrenID), nil
+	}
+	field := v.fields[len(values)-1]
+	obj := d.newContainer(id, values[len(values)-1], fieldClasses[field], childrenID)
+	obj.Artist, obj.Album, obj.Genre = filter[ArtistField], filter[AlbumField], filter[GenreField]
+	if field == AlbumField {
+		d.setAlbumArt(obj, ctx)
+	}
+	return obj, nil
+}
+
+func (d *Directory) GetChildren(id filesystem.ID, ctx context.Context) ([]*cds.Object, error) {
+	if !d.isVirtual(id) {
+		return d.ContentDirectory.GetChildren(id, ctx)
+	}
+	parent, err := d.Get(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the order of the index
+	children := make([]*cds.Object, 0, len(parent.ChildrenID))
+	for _, childID := range parent.ChildrenID {
+		child, err := d.Get(childID, ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// The index may be lagging behind the filesystem
+			continue
+		}
+		children = append(children, child)
+	}
+	return children, ctx.Err()
+}
+
+func (d *Directory) LastModTime() time.Time {
+	t := d.ContentDirectory.LastModTime()
+	if it := d.Index.LastModTime(); it.After(t) {
+		return it
+	}
+	return t
+}
+
+// getTrackReference returns the reference to a track listed in a music view
+func (d *Directory) getTrackReference(id, trackID filesystem.ID, filter Filter, ctx context.Context) (*cds.Object, error) {
+	if t, ok := d.Index.Track(trackID); !ok || !filter.Match(t) {
+		return nil, os.ErrNotExist
+	}
+	return d.getReference(id, trackID, ctx)
+}
+
+// getRecentReference returns the reference to an item of a "Recently ..." container
+func (d *Directory) getRecentReference(id filesystem.ID, itemIDs []filesystem.ID, ctx context.Context) (*cds.Object, error) {
+	value, err := url.PathUnescape(id.BaseName())
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	for _, itemID := range itemIDs {
+		if itemID == filesystem.ID(value) {
+			return d.getReference(id, itemID, ctx)
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// getReference returns a copy of the item itemID of the underlying ContentDirectory, identified by id
+func (d *Directory) getReference(id, itemID filesystem.ID, ctx context.Context) (*cds.Object, error) {
+	obj, err := d.ContentDirectory.Get(itemID, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if obj.IsContainer() {
+		return nil, os.ErrNotExist
+	}
+	// Do not alter the object of the underlying ContentDirectory, which could be cached
+	ref := *obj
+	ref.ID, ref.RefID = id, obj.ID
+	return &ref, nil
+}
+
+func (d *Directory) getRoot(ctx context.Context) (*cds.Object, error) {
+	obj, err := d.ContentDirectory.Get(filesystem.RootID, ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Do not alter the object of the underlying ContentDirectory, which could be cached
+	root := *obj
+	root.ChildrenID = make([]filesystem.ID, len(obj.ChildrenID), len(obj.ChildrenID)+3)
+	copy(root.ChildrenID, obj.ChildrenID)
+	if d.Music {
+		root.ChildrenID = append(root.ChildrenID, MusicID)
+	}
+	if d.Recent > 0 {
+		root.ChildrenID = append(root.ChildrenID, RecentlyAddedID, RecentlyPlayedID)
+	}
+	return &root, nil
+}
+
+func (d *Directory) isVirtual(id filesystem.ID) bool {
+	if d.Recent > 0 && (id == RecentlyAddedID || id == RecentlyPlayedID) {
+		return true
+	}
+	_, _, ok := d.parseID(id)
+	return ok
+}
+
+func (d *Directory) parseID(id filesystem.ID) (*view, []string, bool) {
+	if !d.Music {
+		return nil, nil, false
+	}
+	return parseID(id)
+}
+
+func (d *Directory) viewIDs() []filesystem.ID {
+	ids := make([]filesystem.ID, len(views))
+	for i, v := range views {
+		ids[i] = MusicID.ChildID(v.name)
+	}
+	return ids
+}
+
+func (d *Directory) newContainer(id filesystem.ID, title, class string, childrenID []filesystem.ID) *cds.Object {
+	return &cds.Object{
+		Object: filesystem.Object{
+			ID:         id,
+			FileItem:   filesystem.FileItem{ModTime: d.Index.LastModTime()},
+			Name:       title,
+			IsDir:      true,
+			ChildrenID: childrenID,
+		},
+		Title:     title,
+		UPnPClass: class,
+		MimeType:  cds.FolderType,
+	}
+}
+
+// setAlbumArt uses the album art of the first track of the album
+func (d *Directory) setAlbumArt(obj *cds.Object, ctx context.Context) {
+	if len(obj.ChildrenID) == 0 {
+		return
+	}
+	if track, err := d.Get(obj.ChildrenID[0], ctx); err == nil {
+		obj.AlbumArtURI, obj.AlbumArtProfileID = track.AlbumArtURI, track.AlbumArtProfileID
+	}
+}
+
+// parseID splits the identifier of a virtual container into its view and field values.
+// It returns false if id is not a virtual container, and a nil view for MusicID itself.
+func parseID(id filesystem.ID) (v *view, values []string, ok bool) {
+	if id == MusicID {
+		return nil, nil, true
+	}
+	rest := strings.TrimPrefix(id.String(), MusicID.String()+"/")
+	if rest == id.String() {
+		return nil, nil, false
+	}
+	parts := strings.Split(rest, "/")
+	for i := range views {
+		if views[i].name == parts[0] {
+			v = &views[i]
+			break
+		}
+	}
+	if v == nil {
+		return nil, nil, false
+	}
+	values = make([]string, len(parts)-1)
+	for i, part := range parts[1:] {
+		value, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, nil, false
+		}
+		values[i] = value
+	}
+	return v, values, true
+}
+
+// refID returns the identifier of the reference to the item itemID in the virtual container parentID
+func refID(parentID, itemID filesystem.ID) filesystem.ID {
+	return parentID.ChildID(escape(itemID.String()))
+}
+
+func refIDs(parentID filesystem.ID, itemIDs []filesystem.ID) []filesystem.ID {
+	ids := make([]filesystem.ID, len(itemIDs))
+	for i, itemID := range itemIDs {
+		ids[i] = refID(parentID, itemID)
+	}
+	return ids
+}
+
+// escape turns a field value into a valid identifier component
+func escape(value string) string {
+	s := url.PathEscape(value)
+	if strings.HasPrefix(s, ".") {
+		s = "%2E" + s[1:]
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package library
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+func TestParseID(t *testing.T) {
+	var data = map[filesystem.ID][]string{
+		MusicID.ChildID("artists"):                                  {},
+		MusicID.ChildID("artists").ChildID(escape("AC/DC")):         {"AC/DC"},
+		MusicID.ChildID("albums").ChildID(escape("...And Justice")): {"...And Justice"},
+		MusicID.ChildID("years").ChildID("1979"):                    {"1979"},
+	}
+	for id, expected := range data {
+		v, values, ok := parseID(id)
+		if !ok || v == nil {
+			t.Errorf("parseID(%q), expected a view", id)
+		} else if !reflect.DeepEqual(values, expected) {
+			t.Errorf("parseID(%q), expected %q, got %q", id, expected, values)
+		}
+	}
+	for _, id := range []filesystem.ID{"/music", "/.music/foo", filesystem.RootID} {
+		if _, _, ok := parseID(id); ok {
+			t.Errorf("parseID(%q), expected a non-virtual ID", id)
+		}
+	}
+}
+
+// itemDirectory returns an audio item for any ID
+type itemDirectory struct {
+	cds.ContentDirectory
+}
+
+func (itemDirectory) Get(id filesystem.ID, _ context.Context) (*cds.Object, error) {
+	return &cds.Object{Object: filesystem.Object{ID: id}, MimeType: types.NewMIME("audio/mpeg")}, nil
+}
+
+func TestReferences(t *testing.T) {
+	x, _ := NewIndex(nil, nil)
+	x.Put(Track{ID: "/a/1.mp3", Title: "One", Artist: "A", Album: "X", Genre: "Rock", Year: "1990"})
+	x.Put(Track{ID: "/b/1.mp3", Title: "Other", Artist: "B", Album: "Y", Genre: "Jazz", Year: "1990"})
+	x.Update(&cds.Object{Object: filesystem.Object{ID: "/a/1.mp3", FileItem: filesystem.FileItem{ModTime: time.Now()}}})
+	d := &Directory{ContentDirectory: itemDirectory{}, Index: x, Music: true, Recent: 10}
+	ctx := context.Background()
+
+	for _, parentID := range []filesystem.ID{
+		MusicID.ChildID("albums").ChildID("X"),
+		MusicID.ChildID("artists").ChildID("A").ChildID("X"),
+		MusicID.ChildID("years").ChildID("1990"),
+		RecentlyAddedID,
+	} {
+		parent, err := d.Get(parentID, ctx)
+		if err != nil {
+			t.Fatalf("Get(%q): %s", parentID, err)
+		}
+		children, err := d.GetChildren(parentID, ctx)
+		if err != nil || len(children) == 0 || len(children) != len(parent.ChildrenID) {
+			t.Fatalf("GetChildren(%q), expected %d children, got %d (%v)", parentID, len(parent.ChildrenID), len(children), err)
+		}
+		for _, child := range children {
+			if child.ID.ParentID() != parentID {
+				t.Errorf("GetChildren(%q), expected the parent ID of %q to be the container", parentID, child.ID)
+			}
+			if _, ok := x.Track(child.RefID); !ok {
+				t.Errorf("GetChildren(%q), expected a reference to a track, got %q", parentID, child.RefID)
+			}
+		}
+	}
+
+	// The track does not belong to the album
+	if _, err := d.Get(refID(MusicID.ChildID("albums").ChildID("X"), "/b/1.mp3"), ctx); err != os.ErrNotExist {
+		t.Errorf("expected a reference to a track of another album not to exist, got %v", err)
+	}
+	if _, err := d.Get(refID(RecentlyAddedID, "/b/1.mp3"), ctx); err != os.ErrNotExist {
+		t.Errorf("expected a reference to an item not recently added not to exist, got %v", err)
+	}
+}
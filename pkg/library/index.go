@@ -0,0 +1,356 @@
+package library
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+// Unknown replaces the missing metadata
+const Unknown = "Unknown"
+
+// Field is an indexed metadata field
+type Field int
+
+const (
+	ArtistField Field = iota
+	AlbumField
+	GenreField
+	YearField
+)
+
+// Track holds the indexed metadata of an audio item
+type Track struct {
+	ID          filesystem.ID
+	Title       string
+	Artist      string
+	Album       string
+	Genre       string
+	Year        string
+	TrackNumber int
+}
+
+// TrackFromObject extracts the metadata of an audio item. It returns false for other objects.
+func TrackFromObject(obj *cds.Object) (t Track, ok bool) {
+	if obj.IsContainer() || obj.MimeType.Type != "audio" {
+		return
+	}
+	t = Track{
+		ID:          obj.ID,
+		Title:       obj.Title,
+		Artist:      orUnknown(obj.Artist),
+		Album:       orUnknown(obj.Album),
+		Genre:       orUnknown(obj.Genre),
+		Year:        Unknown,
+		TrackNumber: obj.TrackNumber,
+	}
+	if !obj.Date.IsZero() {
+		t.Year = strconv.Itoa(obj.Date.Year())
+	}
+	return t, true
+}
+
+func orUnknown(s string) string {
+	if s = strings.TrimSpace(s); s == "" {
+		return Unknown
+	}
+	return s
+}
+
+// Value returns the value of the given field
+func (t Track) Value(f Field) string {
+	switch f {
+	case ArtistField:
+		return t.Artist
+	case AlbumField:
+		return t.Album
+	case GenreField:
+		return t.Genre
+	case YearField:
+		return t.Year
+	}
+	return ""
+}
+
+// Filter selects the tracks having the given field values
+type Filter map[Field]string
+
+// Match returns true if the track has all the values of the filter
+func (f Filter) Match(t Track) bool {
+	for field, value := range f {
+		if t.Value(field) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Index is an index of the audio tracks, and of the times the items have been added and played.
+// It is kept in memory and, if a cache backend is provided, persisted in it.
+// It also implements cds.Processor to index the objects as they are processed, and cds.PlayRecorder.
+type Index struct {
+	tracks  map[filesystem.ID]Track
+	added   map[filesystem.ID]time.Time
+	played  map[filesystem.ID]time.Time
+	modTime time.Time
+	store   *store
+	mu      sync.RWMutex
+}
+
+// NewIndex creates an index, loading the data persisted in the backend of cm. cm can be nil.
+func NewIndex(cm *cache.Manager, l logging.Logger) (x *Index, err error) {
+	x = &Index{
+		tracks: make(map[filesystem.ID]Track),
+		added:  make(map[filesystem.ID]time.Time),
+		played: make(map[filesystem.ID]time.Time),
+	}
+	if x.store, err = newStore(cm, l); err != nil {
+		return nil, err
+	}
+	err = x.store.loadTracks(func(t Track) {
+		x.tracks[t.ID] = t
+	})
+	if err == nil {
+		err = x.store.loadTimes(addedBucket, func(id filesystem.ID, t time.Time) {
+			x.added[id] = t
+		})
+	}
+	if err == nil {
+		err = x.store.loadTimes(playedBucket, func(id filesystem.ID, t time.Time) {
+			x.played[id] = t
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(x.added) > 0 {
+		x.modTime = time.Now()
+		l.Infof("%d items and %d tracks in the library", len(x.added), len(x.tracks))
+	}
+	return
+}
+
+func (x *Index) String() string {
+	return "LibraryIndex"
+}
+
+// Process implements cds.Processor
+func (x *Index) Process(obj *cds.Object, _ context.Context) {
+	x.Update(obj)
+}
+
+// Update indexes an item: its modification time and, for audio items, its track.
+func (x *Index) Update(obj *cds.Object) {
+	if obj.IsContainer() {
+		return
+	}
+	x.mu.Lock()
+	old, found := x.added[obj.ID]
+	changed := !found || !old.Equal(obj.ModTime)
+	if changed {
+		x.added[obj.ID] = obj.ModTime
+		x.modTime = time.Now()
+	}
+	x.mu.Unlock()
+	if changed {
+		x.store.putTime(addedBucket, obj.ID, obj.ModTime)
+	}
+	if t, ok := TrackFromObject(obj); ok {
+		x.Put(t)
+	}
+}
+
+// Played implements cds.PlayRecorder
+func (x *Index) Played(obj *cds.Object, t time.Time) {
+	x.mu.Lock()
+	if !x.lastPlayed(obj.ID) {
+		// The recently played items are reordered
+		x.modTime = time.Now()
+	}
+	x.played[obj.ID] = t
+	x.mu.Unlock()
+	x.store.putTime(playedBucket, obj.ID, t)
+}
+
+// lastPlayed returns true if id is the most recently played item
+func (x *Index) lastPlayed(id filesystem.ID) bool {
+	last, found := x.played[id]
+	if !found {
+		return false
+	}
+	for other, t := range x.played {
+		if other != id && t.After(last) {
+			return false
+		}
+	}
+	return true
+}
+
+// RecentlyAdded returns the identifiers of the n most recently added items, newest first
+func (x *Index) RecentlyAdded(n int) []filesystem.ID {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return mostRecent(x.added, n)
+}
+
+// RecentlyPlayed returns the identifiers of the n most recently played items, newest first
+func (x *Index) RecentlyPlayed(n int) []filesystem.ID {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return mostRecent(x.played, n)
+}
+
+func mostRecent(times map[filesystem.ID]time.Time, n int) []filesystem.ID {
+	ids := make([]filesystem.ID, 0, len(times))
+	for id := range times {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ti, tj := times[ids[i]], times[ids[j]]; !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+// Put adds or updates a track
+func (x *Index) Put(t Track) {
+	x.mu.Lock()
+	old, found := x.tracks[t.ID]
+	changed := !found || old != t
+	if changed {
+		x.tracks[t.ID] = t
+		x.modTime = time.Now()
+	}
+	x.mu.Unlock()
+	if changed {
+		x.store.putTrack(t)
+	}
+}
+
+// RemoveTree removes the item identified by id, or all the items under it if it is a container.
+func (x *Index) RemoveTree(id filesystem.ID) {
+	prefix := strings.TrimSuffix(id.String(), "/") + "/"
+	x.remove(func(itemID filesystem.ID) bool {
+		return itemID == id || strings.HasPrefix(itemID.String(), prefix)
+	})
+}
+
+// Prune removes the items for which keep returns false, e.g. the ones that have not been seen by a complete scan.
+func (x *Index) Prune(keep func(filesystem.ID) bool) {
+	x.remove(func(itemID filesystem.ID) bool {
+		return !keep(itemID)
+	})
+}
+
+// remove removes the items matching a predicate, from the tracks and the added and played times
+func (x *Index) remove(matches func(filesystem.ID) bool) {
+	removed := make(map[filesystem.ID]bool)
+	x.mu.Lock()
+	for _, ids := range []map[filesystem.ID]time.Time{x.added, x.played} {
+		for itemID := range ids {
+			if matches(itemID) {
+				removed[itemID] = true
+			}
+		}
+	}
+	for itemID := range x.tracks {
+		if matches(itemID) {
+			removed[itemID] = true
+		}
+	}
+	ids := make([]filesystem.ID, 0, len(removed))
+	for itemID := range removed {
+		delete(x.added, itemID)
+		delete(x.tracks, itemID)
+		delete(x.played, itemID)
+		ids = append(ids, itemID)
+	}
+	if len(ids) > 0 {
+		x.modTime = time.Now()
+	}
+	x.mu.Unlock()
+	x.store.delete(ids)
+}
+
+// Len returns the number of tracks
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.tracks)
+}
+
+// LastModTime returns the time of the last change
+func (x *Index) LastModTime() time.Time {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.modTime
+}
+
+// Track returns the track with the given ID, if it is indexed
+func (x *Index) Track(id filesystem.ID) (t Track, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	t, ok = x.tracks[id]
+	return
+}
+
+// Values returns the sorted, distinct values of a field among the tracks matching the filter
+func (x *Index) Values(field Field, filter Filter) []string {
+	x.mu.RLock()
+	seen := make(map[string]bool)
+	for _, t := range x.tracks {
+		if filter.Match(t) {
+			seen[t.Value(field)] = true
+		}
+	}
+	x.mu.RUnlock()
+
+	values := make([]string, 0, len(seen))
+	for v := range seen {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return strings.ToLower(values[i]) < strings.ToLower(values[j])
+	})
+	return values
+}
+
+// Tracks returns the tracks matching the filter, sorted by album, track number and title
+func (x *Index) Tracks(filter Filter) []Track {
+	x.mu.RLock()
+	tracks := make([]Track, 0)
+	for _, t := range x.tracks {
+		if filter.Match(t) {
+			tracks = append(tracks, t)
+		}
+	}
+	x.mu.RUnlock()
+
+	sort.Slice(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.Album != b.Album {
+			return a.Album < b.Album
+		}
+		if a.TrackNumber != b.TrackNumber {
+			return a.TrackNumber < b.TrackNumber
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.ID < b.ID
+	})
+	return tracks
+}
@@ -0,0 +1,118 @@
+package library
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestIndex(t *testing.T) {
+	x, _ := NewIndex(nil, nil)
+	x.Put(Track{ID: "/b/2.mp3", Title: "Two", Artist: "B", Album: "Y", Genre: "Rock", Year: "1990", TrackNumber: 2})
+	x.Put(Track{ID: "/b/1.mp3", Title: "One", Artist: "B", Album: "Y", Genre: "Rock", Year: "1990", TrackNumber: 1})
+	x.Put(Track{ID: "/a/1.mp3", Title: "Alone", Artist: "a", Album: "X", Genre: "Jazz", Year: Unknown})
+
+	if actual, expected := x.Values(ArtistField, nil), []string{"a", "B"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Values(ArtistField), expected %v, got %v", expected, actual)
+	}
+	if actual, expected := x.Values(AlbumField, Filter{GenreField: "Rock"}), []string{"Y"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Values(AlbumField, Rock), expected %v, got %v", expected, actual)
+	}
+
+	var ids []string
+	for _, tr := range x.Tracks(Filter{ArtistField: "B"}) {
+		ids = append(ids, tr.ID.String())
+	}
+	if expected := []string{"/b/1.mp3", "/b/2.mp3"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Tracks(B), expected %v, got %v", expected, ids)
+	}
+
+	x.RemoveTree("/b")
+	if x.Len() != 1 {
+		t.Errorf("RemoveTree(/b), expected 1 track left, got %d", x.Len())
+	}
+}
+
+func TestIndexRecent(t *testing.T) {
+	x, _ := NewIndex(nil, nil)
+	now := time.Now()
+	for i, id := range []filesystem.ID{"/a", "/b", "/c"} {
+		obj := &cds.Object{Object: filesystem.Object{ID: id, FileItem: filesystem.FileItem{ModTime: now.Add(time.Duration(i) * time.Hour)}}}
+		x.Update(obj)
+		x.Played(obj, now.Add(-time.Duration(i)*time.Hour))
+	}
+
+	if actual, expected := x.RecentlyAdded(2), []filesystem.ID{"/c", "/b"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("RecentlyAdded(2), expected %v, got %v", expected, actual)
+	}
+	if actual, expected := x.RecentlyPlayed(5), []filesystem.ID{"/a", "/b", "/c"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("RecentlyPlayed(5), expected %v, got %v", expected, actual)
+	}
+}
+
+func TestIndexPlayedModTime(t *testing.T) {
+	x, _ := NewIndex(nil, nil)
+	obj := &cds.Object{Object: filesystem.Object{ID: "/a"}}
+	x.Played(obj, time.Now())
+	modTime := x.LastModTime()
+	if modTime.IsZero() {
+		t.Fatal("expected the first play to change the index")
+	}
+	x.Played(obj, time.Now())
+	if !x.LastModTime().Equal(modTime) {
+		t.Error("expected playing the last played item again to keep the index unchanged")
+	}
+}
+
+func TestIndexPersistence(t *testing.T) {
+	l := logging.NewTesting(t)
+	be, err := cache.Open("mem://library-persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := NewIndex(&cache.Manager{Backend: be, L: l}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	track := Track{ID: "/a/1.mp3", Title: "One", Artist: "A", Album: "X", Genre: "Rock", Year: "1990"}
+	x.Put(track)
+	x.Played(&cds.Object{Object: filesystem.Object{ID: track.ID}}, time.Now())
+
+	y, err := NewIndex(&cache.Manager{Backend: be, L: l}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracks := y.Tracks(nil); len(tracks) != 1 || tracks[0] != track {
+		t.Errorf("expected the track to be loaded, got %v", tracks)
+	}
+	if played := y.RecentlyPlayed(5); !reflect.DeepEqual(played, []filesystem.ID{track.ID}) {
+		t.Errorf("expected the play to be loaded, got %v", played)
+	}
+}
+
+func TestIndexUnversionedEntries(t *testing.T) {
+	be, err := cache.Open("mem://library-unversioned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An entry stored before the buckets were versioned
+	b, _ := be.Bucket(tracksBucket)
+	b.Put([]byte("/a/1.mp3"), []byte("garbage"))
+
+	x, err := NewIndex(&cache.Manager{Backend: be, L: logging.NewTesting(t)}, logging.NewTesting(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Len() != 0 {
+		t.Errorf("expected the unversioned entries to be dropped, got %d tracks", x.Len())
+	}
+	schemas, _ := be.Bucket(cache.SchemaBucket)
+	if data, err := schemas.Get([]byte(tracksBucket)); err != nil || data == nil {
+		t.Errorf("expected the schema of the bucket to be recorded, got %q, %v", data, err)
+	}
+}
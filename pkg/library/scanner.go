@@ -0,0 +1,347 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+const (
+	ProgressRoute = "library-progress"
+
+	// DefaultConcurrency is the default number of objects processed concurrently by the scanner
+	DefaultConcurrency = 4
+
+	// DefaultRecent is the default number of items of the "Recently added" and "Recently played" containers
+	DefaultRecent = 50
+
+	// progressInterval is the delay between two progress reports in the logs
+	progressInterval = 30 * time.Second
+)
+
+// Scanner states
+const (
+	StateIdle     = "idle"
+	StateScanning = "scanning"
+	StateDone     = "done"
+)
+
+// Config configures the library
+type Config struct {
+	// Scan enables the initial scan of the whole directory. Otherwise, the objects are indexed as they are browsed.
+	Scan bool `json:"scan"`
+	// Concurrency is the maximum number of objects processed concurrently by the scan
+	Concurrency int `json:"concurrency"`
+	// Recent is the number of items listed in the "Recently added" and "Recently played" containers, 0 to disable them.
+	Recent int `json:"recent"`
+}
+
+// Progress reports the progress of the scan
+type Progress struct {
+	State       string    `json:"state"`
+	Resumed     bool      `json:"resumed"`
+	StartedAt   time.Time `json:"startedAt,omitempty"`
+	FinishedAt  time.Time `json:"finishedAt,omitempty"`
+	Directories int       `json:"directories"`
+	Items       int       `json:"items"`
+	Errors      int       `json:"errors"`
+	Tracks      int       `json:"tracks"`
+}
+
+// Scanner fills the Index with the items of a ContentDirectory, then keeps it up to date.
+// The scanned directories are recorded in the database of the Index, so an interrupted scan resumes where it stopped.
+// It implements suture.Service and serves its progress as JSON.
+type Scanner struct {
+	d           cds.ContentDirectory
+	x           *Index
+	scan        bool
+	concurrency int
+
+	pending map[filesystem.ID]bool
+	wake    chan struct{}
+	done    chan struct{}
+	stop    sync.Once
+
+	progress Progress
+	mu       sync.Mutex
+	l        logging.Logger
+}
+
+// NewScanner creates a Scanner. The ContentDirectory must provide the metadata of the items, i.e. be processed by ffprobe.
+func NewScanner(c Config, d cds.ContentDirectory, x *Index, l logging.Logger) *Scanner {
+	s := &Scanner{
+		d:           d,
+		x:           x,
+		scan:        c.Scan,
+		concurrency: c.Concurrency,
+		pending:     make(map[filesystem.ID]bool),
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		progress:    Progress{State: StateIdle},
+		l:           l,
+	}
+	if s.concurrency <= 0 {
+		s.concurrency = DefaultConcurrency
+	}
+	return s
+}
+
+func (s *Scanner) String() string {
+	return "library.scanner"
+}
+
+// Serve scans the whole directory, if enabled, then rescans the invalidated objects until Stop is called
+func (s *Scanner) Serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.done
+		cancel()
+	}()
+
+	if s.scan {
+		s.scanAll(ctx)
+	}
+
+	for {
+		select {
+		case <-s.wake:
+			for _, id := range s.takePending() {
+				if err := s.rescan(id, ctx); err != nil && ctx.Err() == nil {
+					s.l.Warnf("cannot rescan %s: %s", id, err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the scanner. It can be called before Serve, and several times.
+func (s *Scanner) Stop() {
+	s.stop.Do(func() { close(s.done) })
+}
+
+// Invalidate schedules the rescan of the given objects
+func (s *Scanner) Invalidate(ids []filesystem.ID) {
+	s.mu.Lock()
+	for _, id := range ids {
+		s.pending[id] = true
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Progress returns the progress of the scan
+func (s *Scanner) Progress() Progress {
+	s.mu.Lock()
+	p := s.progress
+	s.mu.Unlock()
+	p.Tracks = s.x.Len()
+	return p
+}
+
+// ServeHTTP serves the progress as JSON
+func (s *Scanner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.Progress()); err != nil {
+		logging.FromContext(r.Context(), s.l).Warn(err)
+	}
+}
+
+func (s *Scanner) takePending() []filesystem.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]filesystem.ID, 0, len(s.pending))
+	for id := range s.pending {
+		ids = append(ids, id)
+	}
+	s.pending = make(map[filesystem.ID]bool)
+	return ids
+}
+
+func (s *Scanner) update(fn func(*Progress)) {
+	s.mu.Lock()
+	fn(&s.progress)
+	s.mu.Unlock()
+}
+
+// scanAll walks the whole directory, skipping the directories scanned before an interruption.
+// Once done, the items that have not been seen are removed from the index, as they have been deleted
+// while the server was down.
+func (s *Scanner) scanAll(ctx context.Context) {
+	scanned, err := s.x.store.scanned()
+	if err != nil {
+		s.l.Warnf("cannot resume the previous scan: %s", err)
+	}
+	resumed := len(scanned) > 0
+	s.update(func(p *Progress) {
+		*p = Progress{State: StateScanning, Resumed: resumed, StartedAt: time.Now()}
+	})
+	if resumed {
+		s.l.Infof("resuming the library scan, %d directories already scanned", len(scanned))
+	} else {
+		s.l.Info("scanning the library")
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	// seen holds the scanned items, and the directories scanned before an interruption, whose items are kept.
+	// The items under the directories that could not be scanned are kept too.
+	seen := make(map[filesystem.ID]bool)
+	var failed []filesystem.ID
+
+	stack := []filesystem.ID{filesystem.RootID}
+	for len(stack) > 0 {
+		select {
+		case <-ticker.C:
+			p := s.Progress()
+			s.l.Infof("library scan: %d directories, %d items, %d tracks", p.Directories, p.Items, p.Tracks)
+		case <-ctx.Done():
+			s.l.Info("library scan interrupted")
+			return
+		default:
+		}
+
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		subdirs, found := scanned[id]
+		if found {
+			seen[id] = true
+		} else {
+			var items []filesystem.ID
+			if subdirs, items, err = s.scanDirectory(id, ctx); err != nil {
+				if ctx.Err() != nil {
+					s.l.Info("library scan interrupted")
+					return
+				}
+				s.l.Warnf("cannot scan %s: %s", id, err)
+				s.update(func(p *Progress) { p.Errors++ })
+				failed = append(failed, id)
+				continue
+			}
+			for _, item := range items {
+				seen[item] = true
+			}
+			s.x.store.markScanned(id, subdirs)
+		}
+		s.update(func(p *Progress) { p.Directories++ })
+		stack = append(stack, subdirs...)
+	}
+
+	s.x.Prune(func(id filesystem.ID) bool {
+		if seen[id] || seen[id.ParentID()] {
+			return true
+		}
+		for _, dir := range failed {
+			if isUnder(id, dir) {
+				return true
+			}
+		}
+		return false
+	})
+	s.x.store.clearScanned()
+	s.update(func(p *Progress) {
+		p.State = StateDone
+		p.FinishedAt = time.Now()
+	})
+	p := s.Progress()
+	s.l.Infof("library scan done in %s: %d directories, %d items, %d tracks", p.FinishedAt.Sub(p.StartedAt), p.Directories, p.Items, p.Tracks)
+}
+
+// scanDirectory indexes the items of a directory, processing at most s.concurrency of them at once.
+// It returns the subdirectories, and the indexed items.
+func (s *Scanner) scanDirectory(id filesystem.ID, ctx context.Context) (subdirs, items []filesystem.ID, err error) {
+	dir, err := s.d.Get(id, ctx)
+	if err != nil {
+		return
+	}
+	if !dir.IsContainer() {
+		s.index(dir)
+		items = append(items, id)
+		return
+	}
+
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, childID := range dir.ChildrenID {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(childID filesystem.ID) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			child, err := s.d.Get(childID, ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.l.Warnf("cannot scan %s: %s", childID, err)
+					s.update(func(p *Progress) { p.Errors++ })
+				}
+				return
+			}
+			if child.IsContainer() {
+				mu.Lock()
+				subdirs = append(subdirs, childID)
+				mu.Unlock()
+				return
+			}
+			s.index(child)
+			mu.Lock()
+			items = append(items, childID)
+			mu.Unlock()
+		}(childID)
+	}
+	wg.Wait()
+	return subdirs, items, ctx.Err()
+}
+
+// rescan indexes the object identified by id, and its descendants
+func (s *Scanner) rescan(id filesystem.ID, ctx context.Context) error {
+	obj, err := s.d.Get(id, ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			// The object has been removed
+			s.x.RemoveTree(id)
+		}
+		return nil
+	}
+	if !obj.IsContainer() {
+		s.index(obj)
+		return nil
+	}
+	return cds.Walk(s.d, id, ctx, func(o *cds.Object) error {
+		s.index(o)
+		return ctx.Err()
+	})
+}
+
+// isUnder returns true if id is dir or one of its descendants
+func isUnder(id, dir filesystem.ID) bool {
+	return id == dir || strings.HasPrefix(id.String(), strings.TrimSuffix(dir.String(), "/")+"/")
+}
+
+func (s *Scanner) index(obj *cds.Object) {
+	s.update(func(p *Progress) { p.Items++ })
+	s.x.Update(obj)
+}
@@ -0,0 +1,73 @@
+package library
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestScannerStop(t *testing.T) {
+	l := logging.NewTesting(t)
+	x, err := NewIndex(nil, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScanner(Config{}, nil, x, l)
+	// Stopping before serving must neither panic nor block Serve
+	s.Stop()
+	s.Stop()
+	done := make(chan struct{})
+	go func() {
+		s.Serve()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Serve did not return after Stop")
+	}
+}
+
+func TestScanAllPrunes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dms-library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", "kept.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := filesystem.New(filesystem.Config{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := logging.NewTesting(t)
+	x, err := NewIndex(nil, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Deleted while the server was down
+	x.Put(Track{ID: "/sub/deleted.mp3", Title: "Deleted", Artist: "Gone"})
+	x.Played(&cds.Object{Object: filesystem.Object{ID: "/deleted.mp3"}}, time.Now())
+
+	s := NewScanner(Config{Scan: true}, &cds.FilesystemContentDirectory{FS: fs}, x, l)
+	s.scanAll(context.Background())
+
+	if ids := x.RecentlyAdded(10); len(ids) != 1 || ids[0] != "/sub/kept.mp3" {
+		t.Errorf("expected only the existing item to be indexed, got %v", ids)
+	}
+	if x.Len() != 0 || len(x.RecentlyPlayed(10)) != 0 {
+		t.Errorf("expected the deleted items to be removed, got %d tracks and %v", x.Len(), x.RecentlyPlayed(10))
+	}
+}
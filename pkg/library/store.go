@@ -0,0 +1,145 @@
+package library
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+const (
+	// tracksBucket holds the indexed tracks, by ID
+	tracksBucket = "library"
+	// addedBucket holds the modification times of the items, by ID
+	addedBucket = "library-added"
+	// playedBucket holds the last time the items have been played, by ID
+	playedBucket = "library-played"
+	// scanBucket holds the directories already scanned by an unfinished scan, with their subdirectories
+	scanBucket = "library-scan"
+)
+
+// bucketSamples are the types of the values of the buckets, which define their schemas
+var bucketSamples = map[string]interface{}{
+	tracksBucket: Track{},
+	addedBucket:  time.Time{},
+	playedBucket: time.Time{},
+	scanBucket:   []filesystem.ID{},
+}
+
+// store persists the index and the scan progress in the buckets of a cache backend. The methods of a nil store do nothing.
+// The values are encoded with cache.GobCodec; the buckets are versioned like the cache ones, see cache.SchemaVersioner,
+// and opened through the cache manager so they are included in its maintenance operations.
+type store struct {
+	buckets map[string]cache.Bucket
+	l       logging.Logger
+}
+
+func newStore(cm *cache.Manager, l logging.Logger) (*store, error) {
+	if cm == nil || cm.Backend == nil {
+		return nil, nil
+	}
+	s := &store{buckets: make(map[string]cache.Bucket), l: l}
+	for name, sample := range bucketSamples {
+		b, err := cm.OpenBucket(name, sample)
+		if err != nil {
+			return nil, err
+		}
+		s.buckets[name] = b
+	}
+	return s, nil
+}
+
+func (s *store) loadTracks(fn func(Track)) error {
+	return s.forEach(tracksBucket, func(k, v []byte) {
+		var t Track
+		if err := cache.GobCodec.Decode(v, &t); err != nil {
+			s.l.Warnf("ignoring invalid track %q: %s", k, err)
+			return
+		}
+		fn(t)
+	})
+}
+
+func (s *store) putTrack(t Track) {
+	s.put(tracksBucket, t.ID, t)
+}
+
+func (s *store) loadTimes(bucket string, fn func(filesystem.ID, time.Time)) error {
+	return s.forEach(bucket, func(k, v []byte) {
+		var t time.Time
+		if err := cache.GobCodec.Decode(v, &t); err == nil {
+			fn(filesystem.ID(k), t)
+		}
+	})
+}
+
+func (s *store) putTime(bucket string, id filesystem.ID, t time.Time) {
+	s.put(bucket, id, t)
+}
+
+// delete removes the given identifiers from all the buckets of the index
+func (s *store) delete(ids []filesystem.ID) {
+	if s == nil {
+		return
+	}
+	for _, name := range []string{tracksBucket, addedBucket, playedBucket} {
+		for _, id := range ids {
+			if err := s.buckets[name].Delete([]byte(id)); err != nil {
+				s.l.Error(err)
+				return
+			}
+		}
+	}
+}
+
+// scanned returns the directories marked as scanned, with their subdirectories
+func (s *store) scanned() (dirs map[filesystem.ID][]filesystem.ID, err error) {
+	dirs = make(map[filesystem.ID][]filesystem.ID)
+	err = s.forEach(scanBucket, func(k, v []byte) {
+		var subdirs []filesystem.ID
+		// Invalid entries are scanned again
+		if err := cache.GobCodec.Decode(v, &subdirs); err == nil {
+			dirs[filesystem.ID(k)] = subdirs
+		}
+	})
+	return
+}
+
+func (s *store) markScanned(id filesystem.ID, subdirs []filesystem.ID) {
+	s.put(scanBucket, id, subdirs)
+}
+
+func (s *store) clearScanned() {
+	if s == nil {
+		return
+	}
+	if err := s.buckets[scanBucket].Clear(); err != nil {
+		s.l.Error(err)
+	}
+}
+
+func (s *store) forEach(bucket string, fn func(k, v []byte)) error {
+	if s == nil {
+		return nil
+	}
+	return s.buckets[bucket].ForEach(func(k, v []byte) error {
+		fn(k, v)
+		return nil
+	})
+}
+
+func (s *store) put(bucket string, id filesystem.ID, value interface{}) {
+	if s == nil {
+		return
+	}
+	var buf bytes.Buffer
+	err := cache.GobCodec.Encode(&buf, value)
+	if err == nil {
+		err = s.buckets[bucket].Put([]byte(id), buf.Bytes())
+	}
+	if err != nil {
+		s.l.Error(err)
+	}
+}
@@ -0,0 +1,208 @@
+package playlist
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/h2non/filetype"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+// PlaylistClass is the UPnP class of the playlist containers
+const PlaylistClass = "object.container.playlistContainer"
+
+// defaultRemoteType is the MIME type of the remote entries with an unknown extension, most likely radio streams
+var defaultRemoteType = types.NewMIME("audio/mpeg")
+
+// Config configures the playlists
+type Config struct {
+	// Remote exposes the http(s) URLs of the playlists as items
+	Remote bool `json:"remote"`
+	// Generate offers the playlists of the containers, in M3U8 and XSPF formats
+	Generate bool `json:"generate"`
+	// Recursive includes the items of the subcontainers in the generated playlists
+	Recursive bool `json:"recursive"`
+}
+
+// Directory exposes the playlist files of a ContentDirectory as containers.
+// The children of a playlist are the items of the underlying ContentDirectory it references;
+// the entries outside of the served directories, or that are playlists themselves, are ignored.
+// If Remote is true, the http(s) URLs are exposed as items, identified by their position in the playlist.
+type Directory struct {
+	cds.ContentDirectory
+	FS     *filesystem.Filesystem
+	Remote bool
+	// Parser caches the entries of the playlists
+	Parser *Parser
+}
+
+func (d *Directory) Get(id filesystem.ID, ctx context.Context) (*cds.Object, error) {
+	if !id.IsRoot() && Format(id.ParentID().BaseName()) != "" {
+		if obj, err := d.getRemote(id, ctx); err != os.ErrInvalid {
+			return obj, err
+		}
+	}
+	obj, err := d.ContentDirectory.Get(id, ctx)
+	if err != nil || obj.IsContainer() {
+		return obj, err
+	}
+	if Format(obj.Name) == "" {
+		return obj, nil
+	}
+	entries, err := d.Parser.parse(obj, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not alter the object of the underlying ContentDirectory, which could be cached
+	pl := *obj
+	pl.IsDir = true
+	pl.Size = 0
+	pl.Title = strings.TrimSuffix(obj.Name, path.Ext(obj.Name))
+	pl.UPnPClass = PlaylistClass
+	pl.MimeType = cds.FolderType
+	pl.Resources = nil
+	pl.ChildrenID = d.childrenID(id, filepath.Dir(obj.FilePath), entries)
+	return &pl, nil
+}
+
+func (d *Directory) GetChildren(id filesystem.ID, ctx context.Context) ([]*cds.Object, error) {
+	parent, err := d.Get(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if parent.UPnPClass != PlaylistClass {
+		children, err := d.ContentDirectory.GetChildren(id, ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i, child := range children {
+			if !child.IsContainer() && Format(child.Name) != "" {
+				if pl, err := d.Get(child.ID, ctx); err == nil {
+					children[i] = pl
+				}
+			}
+		}
+		return children, nil
+	}
+	// Keep the order of the playlist
+	children := make([]*cds.Object, 0, len(parent.ChildrenID))
+	for _, childID := range parent.ChildrenID {
+		child, err := d.Get(childID, ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// Missing or unreadable entry
+			continue
+		}
+		children = append(children, child)
+	}
+	return children, ctx.Err()
+}
+
+// childrenID resolves the entries of a playlist located in dir
+func (d *Directory) childrenID(id filesystem.ID, dir string, entries []Entry) []filesystem.ID {
+	ids := make([]filesystem.ID, 0, len(entries))
+	for i, e := range entries {
+		if isRemote(e.Location) {
+			if d.Remote {
+				ids = append(ids, id.ChildID(strconv.Itoa(i)))
+			}
+			continue
+		}
+		if entryID, ok := d.resolve(dir, e.Location); ok {
+			ids = append(ids, entryID)
+		}
+	}
+	return ids
+}
+
+// resolve returns the identifier of a local entry, or false if it is missing, not served or a playlist
+func (d *Directory) resolve(dir, location string) (filesystem.ID, bool) {
+	if u, err := url.Parse(location); err == nil && u.Scheme == "file" {
+		location = u.Path
+	}
+	// Windows playlists are common
+	location = filepath.FromSlash(strings.Replace(location, `\`, "/", -1))
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(dir, location)
+	}
+	if Format(location) != "" {
+		return filesystem.NullID, false
+	}
+	if _, err := os.Stat(location); err != nil {
+		return filesystem.NullID, false
+	}
+	return d.FS.PathID(filepath.Clean(location))
+}
+
+// getRemote builds the item of the remote entry id. It returns os.ErrInvalid if id is not a remote entry.
+func (d *Directory) getRemote(id filesystem.ID, ctx context.Context) (*cds.Object, error) {
+	i, err := strconv.Atoi(id.BaseName())
+	if err != nil || !d.Remote {
+		return nil, os.ErrInvalid
+	}
+	parent, err := d.ContentDirectory.Get(id.ParentID(), ctx)
+	if err != nil || parent.IsContainer() {
+		return nil, os.ErrInvalid
+	}
+	entries, err := d.Parser.parse(parent, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(entries) || !isRemote(entries[i].Location) {
+		return nil, os.ErrNotExist
+	}
+	e := entries[i]
+
+	u, _ := url.Parse(e.Location)
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = u.Host
+	}
+	title := e.Title
+	if title == "" {
+		title = name
+	}
+	mimeType := filetype.GetType(strings.TrimPrefix(path.Ext(u.Path), ".")).MIME
+	if mimeType.Value == "" {
+		mimeType = defaultRemoteType
+	}
+
+	obj := &cds.Object{
+		Object: filesystem.Object{
+			ID:       id,
+			FileItem: parent.FileItem,
+			Name:     name,
+		},
+		Title:    title,
+		MimeType: mimeType,
+	}
+	obj.AddResource(cds.Resource{
+		RemoteURL:    e.Location,
+		ProtocolInfo: cds.ProtocolInfo{MimeType: mimeType},
+		Duration:     e.Duration,
+	})
+	return obj, nil
+}
+
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+func parseFile(filePath, format string) ([]Entry, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, format)
+}
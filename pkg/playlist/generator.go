@@ -0,0 +1,242 @@
+package playlist
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	adi_http "github.com/Adirelle/go-libs/http"
+	"github.com/Adirelle/go-libs/logging"
+	"github.com/gorilla/mux"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+const (
+	GeneratorRoute       = "playlist"
+	RouteFormatParameter = "format"
+	RouteFormatTemplate  = "{format:m3u8|xspf}"
+
+	// RecursiveParameter is the query parameter overriding Recursive, e.g. "?recursive=false"
+	RecursiveParameter = "recursive"
+
+	// MaxDepth is the maximum depth of the subcontainers explored by the recursive playlists
+	MaxDepth = 16
+	// MaxItems is the maximum number of items of the generated playlists
+	MaxItems = 10000
+)
+
+// generatedFormats lists the formats of the generated playlists
+var generatedFormats = []string{"m3u8", "xspf"}
+
+// GeneratorURLSpec returns the URL specification of the playlist of a container, in the given format
+func GeneratorURLSpec(id filesystem.ID, format string) *adi_http.URLSpec {
+	return adi_http.NewURLSpec(GeneratorRoute, RouteFormatParameter, format, cds.RouteObjectIDParameter, id.String())
+}
+
+// Generator serves the playlists of the containers, listing the URLs of their audio and video items.
+// The items are listed in the order of the ContentDirectory, and, if Recursive is true, followed by the
+// items of the subcontainers, depth-first.
+type Generator struct {
+	cds.DirectoryHandler
+	Recursive bool
+	l         logging.Logger
+}
+
+func NewGenerator(d cds.ContentDirectory, recursive bool, l logging.Logger) *Generator {
+	g := &Generator{Recursive: recursive, l: l}
+	g.DirectoryHandler = cds.DirectoryHandler{Directory: d, Handler: g}
+	return g
+}
+
+func (g *Generator) ServeObject(w http.ResponseWriter, r *http.Request, obj *cds.Object) {
+	format := mux.Vars(r)[RouteFormatParameter]
+	if _, found := Formats[format]; !found || !obj.IsContainer() {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	recursive := g.Recursive
+	if value := r.URL.Query().Get(RecursiveParameter); value != "" {
+		var err error
+		if recursive, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, err := g.items(obj.ID, recursive, r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	gen := adi_http.URLGeneratorFromContext(r.Context())
+
+	w.Header().Set("Content-Type", Formats[format])
+	if r.Method == http.MethodHead {
+		return
+	}
+	switch format {
+	case "m3u8":
+		err = writeM3U(w, items, gen)
+	case "xspf":
+		err = writeXSPF(w, obj.Title, items, gen)
+	}
+	if err != nil {
+		logging.FromContext(r.Context(), g.l).Warn(err)
+	}
+}
+
+// items lists the audio and video items of a container. The hidden subcontainers, i.e. the virtual ones
+// added at the root, are not explored. Each container is explored once, down to MaxDepth, and the list
+// is truncated to MaxItems.
+func (g *Generator) items(id filesystem.ID, recursive bool, ctx context.Context) (items []*cds.Object, err error) {
+	seen := make(map[filesystem.ID]bool)
+	var collect func(filesystem.ID, int) error
+	collect = func(id filesystem.ID, depth int) error {
+		seen[id] = true
+		children, err := g.Directory.GetChildren(id, ctx)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if len(items) >= MaxItems {
+				return nil
+			}
+			if seen[child.ID] {
+				continue
+			}
+			if child.IsContainer() {
+				if recursive && depth < MaxDepth && !strings.HasPrefix(child.ID.BaseName(), ".") {
+					if err := collect(child.ID, depth+1); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if len(child.Resources) == 0 {
+				continue
+			}
+			if t := child.MimeType.Type; t == "audio" || t == "video" {
+				seen[child.ID] = true
+				items = append(items, child)
+			}
+		}
+		return nil
+	}
+	err = collect(id, 0)
+	return
+}
+
+// itemURL returns the URL of the first resource of an item, i.e. the one of the FileServer
+func itemURL(obj *cds.Object, gen adi_http.URLGenerator) (string, error) {
+	r := obj.Resources[0]
+	if r.URL == nil {
+		return r.RemoteURL, nil
+	}
+	return gen.URL(r.URL)
+}
+
+// m3uLineBreaks replaces the line breaks, which would start new entries
+var m3uLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func writeM3U(w http.ResponseWriter, items []*cds.Object, gen adi_http.URLGenerator) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "#EXTM3U")
+	for _, obj := range items {
+		url, err := itemURL(obj, gen)
+		if err != nil {
+			return err
+		}
+		title := obj.Title
+		if obj.Artist != "" {
+			title = obj.Artist + " - " + title
+		}
+		secs := -1
+		if d := obj.Resources[0].Duration; d > 0 {
+			secs = int(d.Seconds())
+		}
+		fmt.Fprintf(b, "#EXTINF:%d,%s\n%s\n", secs, m3uLineBreaks.Replace(title), url)
+	}
+	return b.Flush()
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int64  `xml:"duration,omitempty"`
+}
+
+type xspfOutput struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version int         `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+func writeXSPF(w http.ResponseWriter, title string, items []*cds.Object, gen adi_http.URLGenerator) error {
+	pl := xspfOutput{Version: 1, Title: title, Tracks: make([]xspfTrack, len(items))}
+	for i, obj := range items {
+		url, err := itemURL(obj, gen)
+		if err != nil {
+			return err
+		}
+		pl.Tracks[i] = xspfTrack{
+			Location: url,
+			Title:    obj.Title,
+			Creator:  obj.Artist,
+			Album:    obj.Album,
+			Duration: int64(obj.Resources[0].Duration.Seconds() * 1000),
+		}
+	}
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(pl)
+}
+
+// GeneratorDirectory advertises the generated playlists of the containers as resources
+type GeneratorDirectory struct {
+	cds.ContentDirectory
+}
+
+func (d *GeneratorDirectory) Get(id filesystem.ID, ctx context.Context) (*cds.Object, error) {
+	obj, err := d.ContentDirectory.Get(id, ctx)
+	if err != nil || !obj.IsContainer() {
+		return obj, err
+	}
+	return addResources(obj), nil
+}
+
+func (d *GeneratorDirectory) GetChildren(id filesystem.ID, ctx context.Context) ([]*cds.Object, error) {
+	children, err := d.ContentDirectory.GetChildren(id, ctx)
+	for i, child := range children {
+		if child.IsContainer() {
+			children[i] = addResources(child)
+		}
+	}
+	return children, err
+}
+
+// addResources returns a copy of the container with the resources of its playlists
+func addResources(obj *cds.Object) *cds.Object {
+	// Do not alter the object of the underlying ContentDirectory, which could be cached
+	ctn := *obj
+	ctn.Resources = make([]cds.Resource, len(obj.Resources), len(obj.Resources)+len(generatedFormats))
+	copy(ctn.Resources, obj.Resources)
+	for _, format := range generatedFormats {
+		ctn.AddResource(cds.Resource{
+			URL:          GeneratorURLSpec(obj.ID, format),
+			ProtocolInfo: cds.ProtocolInfo{MimeType: types.NewMIME(Formats[format])},
+		})
+	}
+	return &ctn
+}
@@ -0,0 +1,60 @@
+package playlist
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+func TestWriteM3U(t *testing.T) {
+	items := []*cds.Object{
+		{Title: "Song", Artist: "Band", Resources: []cds.Resource{{RemoteURL: "http://host/song.mp3", Duration: 90 * time.Second}}},
+		{Title: "Radio", Resources: []cds.Resource{{RemoteURL: "http://host/stream"}}},
+		{Title: "Two\r\nLines", Resources: []cds.Resource{{RemoteURL: "http://host/lines.mp3"}}},
+	}
+	w := httptest.NewRecorder()
+	if err := writeM3U(w, items, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "#EXTM3U\n#EXTINF:90,Band - Song\nhttp://host/song.mp3\n#EXTINF:-1,Radio\nhttp://host/stream\n" +
+		"#EXTINF:-1,Two Lines\nhttp://host/lines.mp3\n"
+	if actual := w.Body.String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+// loopDirectory is an endless tree, each container holding a song and itself
+type loopDirectory struct {
+	cds.ContentDirectory
+	depth int
+}
+
+func (d *loopDirectory) GetChildren(id filesystem.ID, _ context.Context) ([]*cds.Object, error) {
+	song := &cds.Object{
+		Object:    filesystem.Object{ID: id.ChildID("song.mp3")},
+		MimeType:  types.NewMIME("audio/mpeg"),
+		Resources: []cds.Resource{{RemoteURL: "http://host/song.mp3"}},
+	}
+	self := &cds.Object{Object: filesystem.Object{ID: id, IsDir: true}}
+	d.depth++
+	sub := &cds.Object{Object: filesystem.Object{ID: id.ChildID(strconv.Itoa(d.depth)), IsDir: true}}
+	return []*cds.Object{song, self, sub}, nil
+}
+
+func TestItemsLimits(t *testing.T) {
+	d := &loopDirectory{}
+	g := NewGenerator(d, true, nil)
+	items, err := g.items(filesystem.ID("/music"), true, context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(items) != MaxDepth+1 || d.depth != MaxDepth+1 {
+		t.Errorf("expected %d items, got %d items in %d containers", MaxDepth+1, len(items), d.depth)
+	}
+}
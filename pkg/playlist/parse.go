@@ -0,0 +1,173 @@
+package playlist
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is an entry of a playlist
+type Entry struct {
+	// Location is either a path, using slashes, or an absolute URL
+	Location string
+	Title    string
+	Duration time.Duration
+}
+
+// Formats lists the supported playlist formats, by extension
+var Formats = map[string]string{
+	"m3u":  "audio/x-mpegurl",
+	"m3u8": "application/vnd.apple.mpegurl",
+	"pls":  "audio/x-scpls",
+	"xspf": "application/xspf+xml",
+}
+
+// Format returns the format of a playlist file, or an empty string if the name is not a playlist
+func Format(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if _, found := Formats[ext]; found {
+		return ext
+	}
+	return ""
+}
+
+// Parse reads a playlist in the given format
+func Parse(r io.Reader, format string) ([]Entry, error) {
+	switch format {
+	case "m3u", "m3u8":
+		return parseM3U(r)
+	case "pls":
+		return parsePLS(r)
+	case "xspf":
+		return parseXSPF(r)
+	}
+	return nil, fmt.Errorf("unsupported playlist format: %q", format)
+}
+
+func parseM3U(r io.Reader) (entries []Entry, err error) {
+	sc := bufio.NewScanner(r)
+	var next Entry
+	first := true
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:<seconds>,<title>
+			info := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)
+			if secs, err := strconv.ParseFloat(strings.TrimSpace(info[0]), 64); err == nil && secs > 0 {
+				next.Duration = time.Duration(secs * float64(time.Second))
+			}
+			if len(info) == 2 {
+				next.Title = strings.TrimSpace(info[1])
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			next.Location = line
+			entries = append(entries, next)
+			next = Entry{}
+		}
+	}
+	return entries, sc.Err()
+}
+
+func parsePLS(r io.Reader) ([]Entry, error) {
+	byIndex := make(map[int]*Entry)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		kv := strings.SplitN(strings.TrimSpace(sc.Text()), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := strings.ToLower(kv[0]), strings.TrimSpace(kv[1])
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		i, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+		e := byIndex[i]
+		if e == nil {
+			e = &Entry{}
+			byIndex[i] = e
+		}
+		switch field {
+		case "file":
+			e.Location = value
+		case "title":
+			e.Title = value
+		case "length":
+			if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+				e.Duration = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(byIndex))
+	for i, e := range byIndex {
+		if e.Location != "" {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	entries := make([]Entry, len(indexes))
+	for j, i := range indexes {
+		entries[j] = *byIndex[i]
+	}
+	return entries, nil
+}
+
+type xspfPlaylist struct {
+	Tracks []struct {
+		Location string `xml:"location"`
+		Title    string `xml:"title"`
+		// Duration is in milliseconds
+		Duration int64 `xml:"duration"`
+	} `xml:"trackList>track"`
+}
+
+func parseXSPF(r io.Reader) ([]Entry, error) {
+	var pl xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&pl); err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(pl.Tracks))
+	for _, t := range pl.Tracks {
+		loc := strings.TrimSpace(t.Location)
+		if loc == "" {
+			continue
+		}
+		// Locations are URIs, turn the local ones into paths
+		if u, err := url.Parse(loc); err == nil && (u.Scheme == "" || u.Scheme == "file") {
+			loc = u.Path
+		}
+		entries = append(entries, Entry{
+			Location: loc,
+			Title:    strings.TrimSpace(t.Title),
+			Duration: time.Duration(t.Duration) * time.Millisecond,
+		})
+	}
+	return entries, nil
+}
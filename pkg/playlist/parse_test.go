@@ -0,0 +1,56 @@
+package playlist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	expected := []Entry{
+		{Location: "01 - Intro.mp3", Title: "Intro", Duration: 65 * time.Second},
+		{Location: "../Other/track.flac"},
+		{Location: "http://radio.example.com/stream", Title: "Radio"},
+	}
+	var data = []struct {
+		format  string
+		content string
+	}{
+		{"m3u", "\ufeff#EXTM3U\n#EXTINF:65,Intro\n01 - Intro.mp3\n\n../Other/track.flac\r\n#EXTINF:-1,Radio\nhttp://radio.example.com/stream\n"},
+		{"pls", "[playlist]\nFile3=http://radio.example.com/stream\nTitle3=Radio\nLength3=-1\nFile1=01 - Intro.mp3\nTitle1=Intro\nLength1=65\nFile2=../Other/track.flac\nNumberOfEntries=3\n"},
+		{"xspf", `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track><location>01%20-%20Intro.mp3</location><title>Intro</title><duration>65000</duration></track>
+    <track><location>../Other/track.flac</location></track>
+    <track><location>http://radio.example.com/stream</location><title>Radio</title></track>
+  </trackList>
+</playlist>`},
+	}
+	for _, d := range data {
+		entries, err := Parse(strings.NewReader(d.content), d.format)
+		if err != nil {
+			t.Errorf("Parse(%s): unexpected error: %s", d.format, err)
+		} else if !reflect.DeepEqual(entries, expected) {
+			t.Errorf("Parse(%s): expected %v, got %v", d.format, expected, entries)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var data = map[string]string{
+		"/music/best.M3U":  "m3u",
+		"list.m3u8":        "m3u8",
+		"radio.pls":        "pls",
+		"album.xspf":       "xspf",
+		"song.mp3":         "",
+		"m3u":              "",
+		"/music/best.m3u/": "",
+	}
+	for name, expected := range data {
+		if actual := Format(name); actual != expected {
+			t.Errorf("Format(%q), expected %q, got %q", name, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package playlist
+
+import (
+	"context"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+)
+
+// Parser caches the entries of the playlist files in memory, so they are parsed once as long as they are not modified.
+// The methods of a nil Parser parse the files each time.
+type Parser struct {
+	m cache.Memo
+}
+
+// parsedKey identifies a version of a playlist file
+type parsedKey struct {
+	filePath string
+	modTime  int64
+}
+
+func NewParser(cm *cache.Manager) *Parser {
+	p := &Parser{}
+	p.m = cm.NewMemoryMemo("playlists", p.loader)
+	return p
+}
+
+// parse returns the entries of the playlist file of obj
+func (p *Parser) parse(obj *cds.Object, ctx context.Context) ([]Entry, error) {
+	if p == nil {
+		return parseFile(obj.FilePath, Format(obj.FilePath))
+	}
+	select {
+	case res := <-p.m.Get(parsedKey{obj.FilePath, obj.ModTime.UnixNano()}):
+		value, err := res.Value()
+		if err != nil {
+			return nil, err
+		}
+		return value.([]Entry), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *Parser) loader(key interface{}) (interface{}, error) {
+	k := key.(parsedKey)
+	return parseFile(k.filePath, Format(k.filePath))
+}
@@ -0,0 +1,48 @@
+package playlist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestParserCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "list.m3u")
+	if err := ioutil.WriteFile(filePath, []byte("a.mp3\nb.mp3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	item, err := filesystem.ItemFromPath(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &cds.Object{Object: filesystem.Object{FileItem: item}}
+
+	p := NewParser(&cache.Manager{L: logging.NewTesting(t)})
+	ctx := context.Background()
+	e1, err1 := p.parse(obj, ctx)
+	e2, err2 := p.parse(obj, ctx)
+	if err1 != nil || err2 != nil || len(e1) != 2 || &e1[0] != &e2[0] {
+		t.Errorf("expected the playlist to be parsed once, got %v, %v (%v, %v)", e1, e2, err1, err2)
+	}
+
+	if err := ioutil.WriteFile(filePath, []byte("c.mp3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	obj.ModTime = obj.ModTime.Add(time.Second)
+	if e3, err := p.parse(obj, ctx); err != nil || len(e3) != 1 || e3[0].Location != "c.mp3" {
+		t.Errorf("expected the playlist to be parsed again after a modification, got %v (%v)", e3, err)
+	}
+}
@@ -3,7 +3,10 @@ package processor
 import (
 	"context"
 	"encoding/gob"
-	"regexp"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/Adirelle/dms/pkg/cache"
 	"github.com/Adirelle/dms/pkg/cds"
@@ -12,27 +15,62 @@ import (
 	"github.com/Adirelle/go-libs/logging"
 )
 
-var (
-	coverRegex = regexp.MustCompile(`(?i)(?:cover|front|face|albumart(?:small|large)?)\.(png|jpe?g|gif)$`)
-)
+// DefaultAlbumArtPatterns are the default cover file patterns, by decreasing priority
+var DefaultAlbumArtPatterns = []string{
+	"folder.*",
+	"cover.*",
+	"front.*",
+	"albumartlarge.*",
+	"albumart.*",
+	"albumartsmall.*",
+	"face.*",
+}
+
+// coverExtensions are the extensions of the files that can be used as album art
+var coverExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// AlbumArtConfig configures the album art lookup
+type AlbumArtConfig struct {
+	// Patterns are case-insensitive glob patterns matching the directory covers, by decreasing priority.
+	// When several files match the same pattern, the largest one is used.
+	Patterns []string `json:"patterns"`
+	// PerItem allows items to have their own cover, e.g. "track.jpg" for "track.mp3"
+	PerItem bool `json:"perItem"`
+	// Hide removes the cover files from their directory listing
+	Hide bool `json:"hide"`
+}
 
 type AlbumArtProcessor struct {
-	fs *filesystem.Filesystem
-	m  cache.Memo
-	l  logging.Logger
+	fs       *filesystem.Filesystem
+	patterns []string
+	perItem  bool
+	hide     bool
+	m        cache.Memo
+	l        logging.Logger
 }
 
 type albumArt struct {
 	filesystem.FileItem
-	filesystem.ID
+	// Cover is the directory cover, NullID if none
+	Cover filesystem.ID
+	// Items are the item covers, indexed by item name without extension
+	Items map[string]filesystem.ID
 }
 
 func init() {
 	gob.Register(albumArt{})
 }
 
-func NewAlbumArtProcessor(fs *filesystem.Filesystem, cm *cache.Manager, logger logging.Logger) (a *AlbumArtProcessor) {
-	a = &AlbumArtProcessor{fs: fs, l: logger}
+func NewAlbumArtProcessor(c AlbumArtConfig, fs *filesystem.Filesystem, cm *cache.Manager, logger logging.Logger) (a *AlbumArtProcessor) {
+	a = &AlbumArtProcessor{fs: fs, perItem: c.PerItem, hide: c.Hide, l: logger}
+	for _, pattern := range c.Patterns {
+		pattern = strings.ToLower(pattern)
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			logger.Warnf("ignoring album art pattern %q: %s", pattern, err)
+			continue
+		}
+		a.patterns = append(a.patterns, pattern)
+	}
 	a.m = cm.NewMemo("album-art", albumArt{}, a.loader)
 	return
 }
@@ -42,7 +80,7 @@ func (AlbumArtProcessor) String() string {
 }
 
 func (a *AlbumArtProcessor) Process(obj *cds.Object, ctx context.Context) {
-	if coverRegex.MatchString(obj.Name) {
+	if a.rank(obj.Name) >= 0 {
 		return
 	}
 
@@ -51,16 +89,68 @@ func (a *AlbumArtProcessor) Process(obj *cds.Object, ctx context.Context) {
 		parentID = parentID.ParentID()
 	}
 
-	data := <-a.m.Get(parentID)
-	if data == nil {
+	aa := a.get(parentID)
+	if aa == nil {
 		return
 	}
-	aa := data.(*albumArt)
-	if aa.ID.IsNull() {
+
+	coverID := aa.Cover
+	if a.perItem && !obj.IsContainer() {
+		if id, found := aa.Items[stem(obj.ID.BaseName())]; found {
+			coverID = id
+		}
+	}
+	if coverID.IsNull() {
 		return
 	}
 
-	obj.AlbumArtURI = http.NewURLSpec(cds.FileServerRoute, cds.RouteObjectIDParameter, aa.ID.String())
+	obj.AlbumArtURI = http.NewURLSpec(cds.FileServerRoute, cds.RouteObjectIDParameter, coverID.String())
+}
+
+// Hides implements cds.ObjectHider, hiding the cover files when configured to
+func (a *AlbumArtProcessor) Hides(id filesystem.ID) bool {
+	if !a.hide || !coverExtensions[strings.ToLower(path.Ext(id.BaseName()))] {
+		return false
+	}
+	aa := a.get(id.ParentID())
+	if aa == nil {
+		return false
+	}
+	if id == aa.Cover {
+		return true
+	}
+	itemID, found := aa.Items[stem(id.BaseName())]
+	return found && itemID == id
+}
+
+// Invalidate removes the album art of the given objects, and their parents, from the cache.
+func (a *AlbumArtProcessor) Invalidate(ids []filesystem.ID) {
+	for _, id := range ids {
+		a.m.Delete(id)
+		a.m.Delete(id.ParentID())
+	}
+}
+
+func (a *AlbumArtProcessor) get(parentID filesystem.ID) *albumArt {
+	data, err := (<-a.m.Get(parentID)).Value()
+	if err != nil {
+		return nil
+	}
+	return data.(*albumArt)
+}
+
+// rank returns the index of the first pattern matching the given file name, or -1 if it is not a cover.
+func (a *AlbumArtProcessor) rank(name string) int {
+	name = strings.ToLower(name)
+	if !coverExtensions[path.Ext(name)] {
+		return -1
+	}
+	for i, pattern := range a.patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return i
+		}
+	}
+	return -1
 }
 
 func (a *AlbumArtProcessor) loader(key interface{}) (interface{}, error) {
@@ -73,18 +163,78 @@ func (a *AlbumArtProcessor) loader(key interface{}) (interface{}, error) {
 		return nil, err
 	}
 
-	aa := &albumArt{parent.FileItem, filesystem.NullID}
+	aa := &albumArt{FileItem: parent.FileItem, Cover: filesystem.NullID}
 
 	a.l.Debugf("%d children", len(parent.ChildrenID))
+	var cover *image
+	images := make(map[string]*image)
+	others := make(map[string]bool)
 	for _, childID := range parent.ChildrenID {
-		if !coverRegex.MatchString(childID.BaseName()) {
-			a.l.Debugf("ignoring: %s", childID)
+		name := childID.BaseName()
+		if !coverExtensions[strings.ToLower(path.Ext(name))] {
+			others[stem(name)] = true
 			continue
 		}
-		aa.ID = childID
-		break
+		rank := a.rank(name)
+		if rank < 0 {
+			if !a.perItem {
+				continue
+			}
+			// Only an item cover, ranked after the directory covers
+			rank = len(a.patterns)
+		}
+
+		img := &image{childID, rank, a.size(childID)}
+		if rank < len(a.patterns) && img.betterThan(cover) {
+			cover = img
+		}
+		if a.perItem && img.betterThan(images[stem(name)]) {
+			images[stem(name)] = img
+		}
+	}
+	if cover != nil {
+		aa.Cover = cover.id
+	}
+
+	for name, img := range images {
+		if others[name] {
+			if aa.Items == nil {
+				aa.Items = make(map[string]filesystem.ID)
+			}
+			aa.Items[name] = img.id
+		}
 	}
 
-	a.l.Debugf("result: %v", aa.ID)
+	a.l.Debugf("result: %v, %d item covers", aa.Cover, len(aa.Items))
 	return aa, nil
 }
+
+// image is a candidate cover
+type image struct {
+	id   filesystem.ID
+	rank int
+	size int64
+}
+
+// betterThan returns true if i has a better rank than other, or the same rank and a larger size.
+// Any image is better than a nil one.
+func (i *image) betterThan(other *image) bool {
+	return other == nil || i.rank < other.rank || (i.rank == other.rank && i.size > other.size)
+}
+
+func (a *AlbumArtProcessor) size(id filesystem.ID) int64 {
+	filePath, err := a.fs.FilePath(id)
+	if err != nil {
+		return 0
+	}
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// stem returns the file name without its extension
+func stem(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name))
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/http"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestAlbumArtRank(t *testing.T) {
+	a := &AlbumArtProcessor{patterns: []string{"folder.*", "cover.png", "front*.*"}}
+	var data = map[string]int{
+		"Folder.JPG":     0,
+		"folder.png":     0,
+		"cover.png":      1,
+		"cover.jpg":      -1,
+		"front-big.jpeg": 2,
+		"front.txt":      -1,
+		"track.mp3":      -1,
+	}
+	for name, expected := range data {
+		if actual := a.rank(name); actual != expected {
+			t.Errorf("rank(%q), expected %d, got %d", name, expected, actual)
+		}
+	}
+}
+
+func TestAlbumArtLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "album-art")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The sizes tell apart the covers of the same rank
+	for name, size := range map[string]int{
+		"folder.jpg": 10,
+		"cover.jpg":  100,
+		"a.mp3":      10,
+		"a.jpg":      10,
+		"a.png":      50,
+		"b.mp3":      10,
+		"b.jpg":      50,
+		"b.png":      10,
+		"orphan.jpg": 10,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := filesystem.New(filesystem.Config{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := logging.NewTesting(t)
+	c := AlbumArtConfig{Patterns: DefaultAlbumArtPatterns, PerItem: true, Hide: true}
+	a := NewAlbumArtProcessor(c, fs, &cache.Manager{L: l}, l)
+
+	for name, expected := range map[string]bool{
+		"folder.jpg": true,
+		"cover.jpg":  false,
+		"a.mp3":      false,
+		"a.jpg":      false,
+		"a.png":      true,
+		"b.jpg":      true,
+		"b.png":      false,
+		"orphan.jpg": false,
+	} {
+		if actual := a.Hides(filesystem.ID("/" + name)); actual != expected {
+			t.Errorf("Hides(%q), expected %v, got %v", name, expected, actual)
+		}
+	}
+
+	for name, coverID := range map[string]string{"a.mp3": "/a.png", "b.mp3": "/b.jpg"} {
+		obj := &cds.Object{Object: filesystem.Object{ID: filesystem.ID("/" + name), Name: name}}
+		a.Process(obj, context.Background())
+		if expected := http.NewURLSpec(cds.FileServerRoute, cds.RouteObjectIDParameter, coverID); !reflect.DeepEqual(obj.AlbumArtURI, expected) {
+			t.Errorf("expected the album art of %q to be %v, got %v", name, expected, obj.AlbumArtURI)
+		}
+	}
+}
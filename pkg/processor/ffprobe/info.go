@@ -3,6 +3,7 @@ package ffprobe
 import (
 	"encoding/gob"
 	"strconv"
+	"strings"
 
 	"github.com/Adirelle/dms/pkg/filesystem"
 )
@@ -17,7 +18,29 @@ type Info struct {
 	Format  Format   `json:"format"`
 }
 
+// Tags returns the metadata tags of the file, with lower case keys. They merge the format tags with the tags of
+// the first audio stream, as the Ogg and Opus files keep them there. The format tags take precedence.
+func (i *Info) Tags() map[string]string {
+	tags := make(map[string]string)
+	for _, s := range i.Streams {
+		if s.CodecType == "audio" {
+			addTags(tags, s.Tags)
+			break
+		}
+	}
+	addTags(tags, i.Format.Tags)
+	return tags
+}
+
+// addTags adds tags to dst, lowering the case of the keys. Vorbis comments, e.g. in FLAC files, are in upper case.
+func addTags(dst, tags map[string]string) {
+	for k, v := range tags {
+		dst[strings.ToLower(k)] = v
+	}
+}
+
 type Stream struct {
+	Index       int           `json:"index"`
 	CodecName   string        `json:"codec_name"`
 	CodecType   string        `json:"codec_type"`
 	Width       uint          `json:"width"`
@@ -25,15 +48,18 @@ type Stream struct {
 	SampleRate  integerString `json:"sample_rate"`
 	Channels    uint          `json:"channels"`
 	Disposition struct {
-		Default int `json:"default"`
+		Default     int `json:"default"`
+		AttachedPic int `json:"attached_pic"`
 	} `json:"disposition"`
+	Tags map[string]string `json:"tags"`
 }
 
 type Format struct {
-	Duration floatString       `json:"duration"`
-	Size     integerString     `json:"size"`
-	BitRate  integerString     `json:"bit_rate"`
-	Tags     map[string]string `json:"tags"`
+	FormatName string            `json:"format_name"`
+	Duration   floatString       `json:"duration"`
+	Size       integerString     `json:"size"`
+	BitRate    integerString     `json:"bit_rate"`
+	Tags       map[string]string `json:"tags"`
 }
 
 type floatString float64
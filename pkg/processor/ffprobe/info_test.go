@@ -0,0 +1,34 @@
+package ffprobe
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+)
+
+func TestTags(t *testing.T) {
+	var data = map[string]string{
+		"flac": `{"streams": [{"index": 0, "codec_type": "audio"}], "format": {"format_name": "flac",
+			"tags": {"TITLE": "Song", "ARTIST": "Band", "ALBUM": "Record", "GENRE": "Rock", "DATE": "1999-05-01", "TRACKNUMBER": "3/12"}}}`,
+		"ogg": `{"streams": [{"index": 0, "codec_type": "video", "tags": {"TITLE": "Cover"}},
+			{"index": 1, "codec_type": "audio", "tags": {"TITLE": "Song", "ARTIST": "Band", "ALBUM": "Record", "GENRE": "Rock", "DATE": "1999", "TRACKNUMBER": "3"}}],
+			"format": {"format_name": "ogg"}}`,
+	}
+	for name, output := range data {
+		var info Info
+		if err := json.Unmarshal([]byte(output), &info); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		var obj cds.Object
+		if err := setTags(&obj, info.Tags()); err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+		if obj.Title != "Song" || obj.Artist != "Band" || obj.Album != "Record" || obj.Genre != "Rock" || obj.TrackNumber != 3 ||
+			!obj.Date.Equal(time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: unexpected metadata: %q, %q, %q, %q, %d, %s", name, obj.Title, obj.Artist, obj.Album, obj.Genre, obj.TrackNumber, obj.Date)
+		}
+	}
+}
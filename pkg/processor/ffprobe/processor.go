@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"os/exec"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 
 	"github.com/Adirelle/dms/pkg/cache"
 	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/dlna"
 	"github.com/Adirelle/go-libs/logging"
 )
 
@@ -79,22 +82,43 @@ func (p *Processor) probeObject(obj *cds.Object, ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	return setTags(obj, info.Tags())
+}
 
-	if title, ok := info.Format.Tags["title"]; ok {
+// setTags sets the metadata of an object from the tags of its file
+func setTags(obj *cds.Object, tags map[string]string) error {
+	if title, ok := tags["title"]; ok {
 		obj.Title = title
 	}
 
-	if createdStr, ok := info.Format.Tags["creation_time"]; ok {
+	if createdStr, ok := tags["creation_time"]; ok {
 		created, err := time.Parse(time.RFC3339Nano, createdStr)
 		if err != nil {
 			return err
 		}
 		obj.Date = created
+	} else if date, ok := tags["date"]; ok && len(date) >= 4 {
+		// Audio files usually only have the release date, or year
+		if year, err := strconv.Atoi(date[:4]); err == nil {
+			obj.Date = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}
 	}
 
-	obj.Artist = info.Format.Tags["artist"]
-	obj.Genre = info.Format.Tags["genre"]
-	obj.Album = info.Format.Tags["album"]
+	obj.Artist = tags["artist"]
+	obj.Genre = tags["genre"]
+	obj.Album = tags["album"]
+
+	track, ok := tags["track"]
+	if !ok {
+		// Vorbis comments
+		track, ok = tags["tracknumber"]
+	}
+	if ok {
+		// Track numbers are often formatted as "number/total"
+		if n, err := strconv.Atoi(strings.SplitN(track, "/", 2)[0]); err == nil {
+			obj.TrackNumber = n
+		}
+	}
 
 	return nil
 }
@@ -124,17 +148,31 @@ func (p *Processor) probeResource(res *cds.Resource, ctx context.Context) error
 		}
 	}
 
+	media := dlna.MediaInfo{
+		Container: info.Format.FormatName,
+		Bitrate:   uint32(info.Format.BitRate.Int64()),
+	}
 	gotVideo, gotAudio := false, false
 	for _, s := range info.Streams {
-		if hasVideo && s.CodecType == "video" && (!gotVideo || s.Disposition.Default == 1) {
+		// Cover art is stored as a single-frame video stream
+		if hasVideo && s.CodecType == "video" && s.Disposition.AttachedPic == 0 && (!gotVideo || s.Disposition.Default == 1) {
 			gotVideo = true
 			res.Resolution.Width = s.Width
 			res.Resolution.Height = s.Height
+			media.VideoCodec, media.Width, media.Height = s.CodecName, s.Width, s.Height
 		}
 		if hasAudio && s.CodecType == "audio" && (!gotAudio || s.Disposition.Default == 1) {
 			gotAudio = true
 			res.SampleFrequency = uint32(s.SampleRate.Int64())
 			res.NrAudioChannels = uint8(s.Channels)
+			media.AudioCodec, media.SampleRate, media.Channels = s.CodecName, uint32(s.SampleRate.Int64()), s.Channels
+		}
+	}
+
+	// Transcoded resources describe their own output
+	if res.ProtocolInfo.Get(cds.DLNAConversion) != dlna.Converted && res.ProtocolInfo.Get(cds.DLNAProfileName) == "" {
+		if pn := media.ProfileName(); pn != "" {
+			res.ProtocolInfo.Set(cds.DLNAProfileName, pn)
 		}
 	}
 
@@ -144,12 +182,60 @@ func (p *Processor) probeResource(res *cds.Resource, ctx context.Context) error
 func (p *Processor) probePath(path string, ctx context.Context) (*Info, error) {
 	select {
 	case res := <-p.m.Get(path):
-		return res.(*Info), nil
+		value, err := res.Value()
+		if err != nil {
+			return nil, err
+		}
+		return value.(*Info), nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
+// Probe returns the probe results of the given file
+func (p *Processor) Probe(path string, ctx context.Context) (*Info, error) {
+	return p.probePath(path, ctx)
+}
+
+// CoverStream returns the index of the stream holding the embedded cover art of the given file, or -1
+func (p *Processor) CoverStream(path string, ctx context.Context) (int, error) {
+	s, err := p.Cover(path, ctx)
+	if err != nil || s == nil {
+		return -1, err
+	}
+	return s.Index, nil
+}
+
+// Cover returns the stream holding the embedded cover art of the given file, or nil
+func (p *Processor) Cover(path string, ctx context.Context) (*Stream, error) {
+	info, err := p.probePath(path, ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range info.Streams {
+		if s.CodecType == "video" && s.Disposition.AttachedPic == 1 {
+			return &info.Streams[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Duration returns the probed duration of the given file, zero if it is unknown.
+func (p *Processor) Duration(path string, ctx context.Context) (time.Duration, error) {
+	info, err := p.probePath(path, ctx)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(float64(info.Format.Duration) * float64(time.Second)), nil
+}
+
+// Invalidate removes the probe results of the given files from the cache.
+func (p *Processor) Invalidate(paths ...string) {
+	for _, path := range paths {
+		p.m.Delete(path)
+	}
+}
+
 func (p *Processor) loader(key interface{}) (value interface{}, err error) {
 	p.lk.Lock()
 	defer p.lk.Unlock()
@@ -0,0 +1,38 @@
+package subtitle
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var srtTimingRe = regexp.MustCompile(`^\s*(\d+:\d{2}:\d{2})[,.](\d{3})\s*-->\s*(\d+:\d{2}:\d{2})[,.](\d{3})(.*)$`)
+
+// SRTToVTT converts SubRip subtitles to WebVTT.
+// Only the header and the timings differ, the cue numbers are valid WebVTT identifiers.
+func SRTToVTT(r io.Reader, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("WEBVTT\n\n"); err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(r)
+	first := true
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		if m := srtTimingRe.FindStringSubmatch(line); m != nil {
+			line = m[1] + "." + m[2] + " --> " + m[3] + "." + m[4] + m[5]
+		}
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,22 @@
+package subtitle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSRTToVTT(t *testing.T) {
+	var data = map[string]string{
+		"\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\nHello\r\n\r\n2\r\n00:01:00,100 --> 00:01:03,000\r\n<i>World</i>\r\n": "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.500\nHello\n\n2\n00:01:00.100 --> 00:01:03.000\n<i>World</i>\n",
+		"": "WEBVTT\n\n",
+	}
+	for input, expected := range data {
+		var out bytes.Buffer
+		if err := SRTToVTT(strings.NewReader(input), &out); err != nil {
+			t.Errorf("SRTToVTT(%q) returned unexpected error: %s", input, err)
+		} else if actual := out.String(); actual != expected {
+			t.Errorf("SRTToVTT(%q), expected %q, got %q", input, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package subtitle
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/dms/pkg/processor/ffprobe"
+	adi_http "github.com/Adirelle/go-libs/http"
+	"github.com/Adirelle/go-libs/logging"
+	"github.com/gorilla/mux"
+	"github.com/h2non/filetype"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+const (
+	FileRoute            = "subtitle-file"
+	StreamRoute          = "subtitle-stream"
+	RouteFormatParameter = "format"
+	RouteFormatTemplate  = "{format:[a-z]+}"
+	RouteStreamParameter = "stream"
+	RouteStreamTemplate  = "{stream:[0-9]+}"
+
+	// DefaultLimit is the default number of concurrent ffmpeg processes
+	DefaultLimit = 2
+)
+
+type Config struct {
+	// BinPath is the path to ffmpeg, used to extract the embedded subtitles. Empty to disable.
+	BinPath string `json:"binPath"`
+	// Limit is the maximum number of concurrent ffmpeg processes, DefaultLimit if 0
+	Limit uint `json:"limit"`
+	// VTT enables the WebVTT versions of SubRip subtitles
+	VTT bool `json:"vtt"`
+}
+
+// formats maps the subtitle formats, i.e. the file extensions, to their MIME types
+var formats = map[string]string{
+	"srt": "text/srt",
+	"vtt": "text/vtt",
+	"ass": "text/x-ass",
+	"ssa": "text/x-ssa",
+}
+
+// ffmpegFormats maps the formats of the extracted subtitles to ffmpeg muxers
+var ffmpegFormats = map[string]string{
+	"srt": "srt",
+	"vtt": "webvtt",
+}
+
+// textCodecs lists the embedded subtitle codecs that ffmpeg can convert to text formats
+var textCodecs = map[string]bool{
+	"subrip":   true,
+	"ass":      true,
+	"ssa":      true,
+	"webvtt":   true,
+	"mov_text": true,
+	"text":     true,
+}
+
+// Processor pairs videos with the subtitles files sharing their base name, e.g. "movie.mkv" with "movie.srt"
+// or "movie.en.srt", and with their embedded text subtitles.
+// It hides the paired subtitle files from the listings and serves the subtitles.
+type Processor struct {
+	cds.DirectoryHandler
+	fs      *filesystem.Filesystem
+	prober  *ffprobe.Processor
+	binPath string
+	vtt     bool
+	slots   chan struct{}
+	m       cache.Memo
+	l       logging.Logger
+}
+
+// sidecars lists the subtitle files of a directory which are paired with a video
+type sidecars struct {
+	filesystem.FileItem
+	IDs []filesystem.ID
+}
+
+// SchemaVersion implements cache.SchemaVersioner. Version 1 dropped the subtitle files without video.
+func (sidecars) SchemaVersion() int {
+	return 1
+}
+
+func init() {
+	gob.Register(sidecars{})
+}
+
+type track struct {
+	url    *adi_http.URLSpec
+	format string
+	path   string
+}
+
+func (Processor) String() string {
+	return "SubtitleProcessor"
+}
+
+// NewProcessor creates a Processor. prober can be nil, in which case the embedded subtitles are ignored.
+func NewProcessor(c Config, d cds.ContentDirectory, fs *filesystem.Filesystem, prober *ffprobe.Processor, cm *cache.Manager, l logging.Logger) *Processor {
+	if c.Limit == 0 {
+		c.Limit = DefaultLimit
+	}
+	p := &Processor{fs: fs, vtt: c.VTT, slots: make(chan struct{}, c.Limit), l: l}
+	if prober != nil && c.BinPath != "" {
+		var err error
+		if p.binPath, err = exec.LookPath(c.BinPath); err == nil {
+			p.prober = prober
+		} else {
+			l.Warnf("embedded subtitles disabled: %s", err)
+		}
+	}
+	p.DirectoryHandler = cds.DirectoryHandler{Directory: d, Handler: p}
+	p.m = cm.NewMemo("subtitles", sidecars{}, p.loader)
+	return p
+}
+
+func (p *Processor) Process(obj *cds.Object, ctx context.Context) {
+	if obj.IsContainer() || obj.MimeType.Type != "video" {
+		return
+	}
+	for _, t := range p.tracks(obj, ctx) {
+		obj.AddResource(cds.Resource{
+			URL:          t.url,
+			ProtocolInfo: cds.ProtocolInfo{MimeType: types.NewMIME(formats[t.format])},
+			FilePath:     t.path,
+		})
+		obj.Captions = append(obj.Captions, cds.Caption{URL: t.url, Type: t.format})
+	}
+}
+
+// Hides implements cds.ObjectHider. The subtitle files without video are left visible.
+func (p *Processor) Hides(id filesystem.ID) bool {
+	if !isSubtitle(id.BaseName()) {
+		return false
+	}
+	data, err := (<-p.m.Get(id.ParentID())).Value()
+	if err != nil {
+		return false
+	}
+	for _, sidecar := range data.(*sidecars).IDs {
+		if sidecar == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CaptionURL implements cds.CaptionLocator, preferring SubRip subtitles
+func (p *Processor) CaptionURL(obj *cds.Object, ctx context.Context) *adi_http.URLSpec {
+	if obj.IsContainer() {
+		return nil
+	}
+	tracks := p.tracks(obj, ctx)
+	for _, t := range tracks {
+		if t.format == "srt" {
+			return t.url
+		}
+	}
+	if len(tracks) > 0 {
+		return tracks[0].url
+	}
+	return nil
+}
+
+// Invalidate removes the subtitle files of the given objects, and their parents, from the cache.
+func (p *Processor) Invalidate(ids []filesystem.ID) {
+	for _, id := range ids {
+		p.m.Delete(id)
+		p.m.Delete(id.ParentID())
+	}
+}
+
+func (p *Processor) tracks(obj *cds.Object, ctx context.Context) (tracks []track) {
+	base := strings.TrimSuffix(obj.Name, path.Ext(obj.Name)) + "."
+	if data, err := (<-p.m.Get(obj.ID.ParentID())).Value(); err == nil {
+		for _, id := range data.(*sidecars).IDs {
+			if !strings.HasPrefix(id.BaseName(), base) {
+				continue
+			}
+			filePath, _ := p.fs.FilePath(id)
+			format := extension(id.BaseName())
+			tracks = append(tracks, track{FileURLSpec(id, format), format, filePath})
+			if format == "srt" && p.vtt {
+				tracks = append(tracks, track{FileURLSpec(id, "vtt"), "vtt", filePath})
+			}
+		}
+	}
+
+	if p.prober == nil {
+		return
+	}
+	info, err := p.prober.Probe(obj.FilePath, ctx)
+	if err != nil {
+		logging.FromContext(ctx, p.l).Warnf("cannot probe %s: %s", obj.FilePath, err)
+		return
+	}
+	for _, s := range info.Streams {
+		if s.CodecType != "subtitle" || !textCodecs[s.CodecName] {
+			continue
+		}
+		tracks = append(tracks, track{StreamURLSpec(obj.ID, s.Index, "srt"), "srt", obj.FilePath})
+		if p.vtt {
+			tracks = append(tracks, track{StreamURLSpec(obj.ID, s.Index, "vtt"), "vtt", obj.FilePath})
+		}
+	}
+	return
+}
+
+// FileURLSpec returns the URL specification of a subtitle file, in the given format
+func FileURLSpec(id filesystem.ID, format string) *adi_http.URLSpec {
+	return adi_http.NewURLSpec(FileRoute, RouteFormatParameter, format, cds.RouteObjectIDParameter, id.String())
+}
+
+// StreamURLSpec returns the URL specification of an embedded subtitle stream, in the given format
+func StreamURLSpec(id filesystem.ID, stream int, format string) *adi_http.URLSpec {
+	return adi_http.NewURLSpec(
+		StreamRoute,
+		RouteFormatParameter, format,
+		RouteStreamParameter, strconv.Itoa(stream),
+		cds.RouteObjectIDParameter, id.String(),
+	)
+}
+
+func (p *Processor) ServeObject(w http.ResponseWriter, r *http.Request, obj *cds.Object) {
+	vars := mux.Vars(r)
+	format := vars[RouteFormatParameter]
+	if _, found := formats[format]; !found || obj.IsContainer() {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if stream, found := vars[RouteStreamParameter]; found {
+		p.serveStream(w, r, obj, stream, format)
+	} else {
+		p.serveFile(w, r, obj, format)
+	}
+}
+
+func (p *Processor) serveFile(w http.ResponseWriter, r *http.Request, obj *cds.Object, format string) {
+	source := extension(obj.Name)
+	if _, found := formats[source]; !found || (source != format && !(source == "srt" && format == "vtt")) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	fh, err := os.Open(obj.FilePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer fh.Close()
+
+	w.Header().Set("Content-Type", formats[format])
+	if source == format {
+		http.ServeContent(w, r, obj.Name, obj.ModTime, fh)
+		return
+	}
+	if r.Method == "HEAD" {
+		return
+	}
+	if err := SRTToVTT(fh, w); err != nil {
+		logging.FromContext(r.Context(), p.l).Warnf("cannot convert %s: %s", obj.FilePath, err)
+	}
+}
+
+func (p *Processor) serveStream(w http.ResponseWriter, r *http.Request, obj *cds.Object, stream, format string) {
+	muxer, found := ffmpegFormats[format]
+	if !found || p.prober == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", formats[format])
+	if r.Method == "HEAD" {
+		return
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-r.Context().Done():
+		return
+	}
+
+	// CommandContext kills ffmpeg when the client disconnects
+	cmd := exec.CommandContext(r.Context(), p.binPath, "-hide_banner", "-nostdin", "-v", "error", "-i", obj.FilePath, "-map", "0:"+stream, "-f", muxer, "pipe:1")
+	out := &countingWriter{Writer: w}
+	var stderr bytes.Buffer
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	p.l.Debugf("running %v", cmd.Args)
+	if err := cmd.Run(); err != nil && r.Context().Err() == nil {
+		err = fmt.Errorf("cannot extract subtitles: %s\n%s", err, stderr.String())
+		logging.FromContext(r.Context(), p.l).Warn(err)
+		if out.n == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// countingWriter counts the bytes written to the underlying writer
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	w.n += int64(n)
+	return
+}
+
+func (p *Processor) loader(key interface{}) (interface{}, error) {
+	parentID := key.(filesystem.ID)
+	parent, err := p.fs.Get(parentID)
+	if err != nil {
+		return nil, err
+	}
+	// The base names of the videos, followed by a dot
+	var bases []string
+	for _, childID := range parent.ChildrenID {
+		name := childID.BaseName()
+		if filetype.GetType(extension(name)).MIME.Type == "video" {
+			bases = append(bases, strings.TrimSuffix(name, path.Ext(name))+".")
+		}
+	}
+	s := &sidecars{FileItem: parent.FileItem}
+	for _, childID := range parent.ChildrenID {
+		if !isSubtitle(childID.BaseName()) {
+			continue
+		}
+		for _, base := range bases {
+			if strings.HasPrefix(childID.BaseName(), base) {
+				s.IDs = append(s.IDs, childID)
+				break
+			}
+		}
+	}
+	return s, nil
+}
+
+func isSubtitle(name string) bool {
+	_, found := formats[extension(name)]
+	return found
+}
+
+func extension(name string) string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+}
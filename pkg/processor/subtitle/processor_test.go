@@ -0,0 +1,45 @@
+package subtitle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestHides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subtitle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"movie.mkv", "movie.en.srt", "movie.vtt", "orphan.srt", "notes.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := filesystem.New(filesystem.Config{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := logging.NewTesting(t)
+	p := NewProcessor(Config{}, &cds.FilesystemContentDirectory{FS: fs}, fs, nil, &cache.Manager{L: l}, l)
+
+	for name, expected := range map[string]bool{
+		"movie.mkv":    false,
+		"movie.en.srt": true,
+		"movie.vtt":    true,
+		"orphan.srt":   false,
+		"notes.txt":    false,
+	} {
+		if actual := p.Hides(filesystem.ID("/" + name)); actual != expected {
+			t.Errorf("Hides(%q), expected %v, got %v", name, expected, actual)
+		}
+	}
+}
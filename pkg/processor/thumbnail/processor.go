@@ -0,0 +1,442 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cache"
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/dlna"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/dms/pkg/processor/ffprobe"
+	adi_http "github.com/Adirelle/go-libs/http"
+	"github.com/Adirelle/go-libs/logging"
+	"github.com/h2non/filetype"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+const (
+	ThumbnailRoute = "thumbnail"
+	CoverRoute     = "cover"
+
+	// MaxSize is the maximum width and height of JPEG_TN and PNG_TN images
+	MaxSize = 160
+
+	JPEGProfile = "JPEG_TN"
+	PNGProfile  = "PNG_TN"
+
+	// maxImageSize is the size of the largest image we accept to decode
+	maxImageSize = 50 << 20
+	// maxImagePixels is the number of pixels of the largest image we accept to decode
+	maxImagePixels = 50 << 20
+
+	// DefaultLimit is the default number of concurrent ffmpeg processes
+	DefaultLimit = 2
+	// GenerationTimeout is the maximum duration of the generation of a thumbnail
+	GenerationTimeout = time.Minute
+)
+
+type Config struct {
+	// BinPath is the path to ffmpeg, used to extract frames from the videos and cover art from the audio files. Empty to disable.
+	BinPath string `json:"binPath"`
+	// Limit is the maximum number of concurrent ffmpeg processes, DefaultLimit if 0
+	Limit uint `json:"limit"`
+}
+
+// Processor sets thumbnails as the album art of video and image items, and serves them.
+// Images are downsized natively while a frame is extracted from videos using ffmpeg.
+// The cover art embedded in audio files (e.g. ID3 APIC, FLAC PICTURE or MP4 covr) is the album art of their items,
+// at its original size, see CoverHandler; its thumbnail is added as a resource.
+// The audio items without cover art keep the album art of their directory, if any.
+// The thumbnails are kept in the cache storage.
+type Processor struct {
+	cds.DirectoryHandler
+	binPath string
+	prober  *ffprobe.Processor
+	slots   chan struct{}
+	m       cache.Memo
+	// generations holds the thumbnails being generated, by file path
+	generations map[string]*generation
+	mu          sync.Mutex
+	l           logging.Logger
+}
+
+// generation is the context of the generation of a thumbnail, shared by the requests waiting for it.
+// It is cancelled once all of them are gone.
+type generation struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// Thumbnail is a cached thumbnail
+type Thumbnail struct {
+	filesystem.FileItem
+	MimeType string
+	Data     []byte
+}
+
+func init() {
+	gob.Register(Thumbnail{})
+}
+
+func (*Processor) String() string {
+	return "ThumbnailProcessor"
+}
+
+// NewProcessor creates a Processor. prober can be nil, in which case the frames are extracted from the beginning of the videos
+// and the embedded cover art is ignored.
+func NewProcessor(c Config, d cds.ContentDirectory, prober *ffprobe.Processor, cm *cache.Manager, l logging.Logger) *Processor {
+	if c.Limit == 0 {
+		c.Limit = DefaultLimit
+	}
+	p := &Processor{
+		prober:      prober,
+		slots:       make(chan struct{}, c.Limit),
+		generations: make(map[string]*generation),
+		l:           l,
+	}
+	if c.BinPath != "" {
+		var err error
+		if p.binPath, err = exec.LookPath(c.BinPath); err != nil {
+			l.Warnf("video thumbnails disabled: %s", err)
+		}
+	}
+	p.DirectoryHandler = cds.DirectoryHandler{Directory: d, Handler: p}
+	p.m = cm.NewMemo("thumbnails", Thumbnail{}, p.loader)
+	return p
+}
+
+func (p *Processor) Process(obj *cds.Object, ctx context.Context) {
+	if obj.IsContainer() {
+		return
+	}
+	profile := p.profile(obj, ctx)
+	if profile == "" {
+		return
+	}
+	if obj.MimeType.Type == "audio" && p.addCover(obj, ctx) {
+		return
+	}
+	obj.AlbumArtURI = URLSpec(obj.ID)
+	obj.AlbumArtProfileID = profile
+}
+
+// coverTypes maps the codecs of the embedded cover art to their MIME types
+var coverTypes = map[string]string{
+	"mjpeg": "image/jpeg",
+	"png":   "image/png",
+	"gif":   "image/gif",
+}
+
+// addCover sets the embedded cover art as the album art of an audio item, and adds its thumbnail as a resource.
+// It returns false if the cover art cannot be served as is.
+func (p *Processor) addCover(obj *cds.Object, ctx context.Context) bool {
+	s, err := p.prober.Cover(obj.FilePath, ctx)
+	if err != nil || s == nil || coverTypes[s.CodecName] == "" {
+		return false
+	}
+	obj.AlbumArtURI = CoverURLSpec(obj.ID)
+	obj.AlbumArtProfileID = coverProfile(s)
+
+	res := cds.Resource{
+		URL:          URLSpec(obj.ID),
+		ProtocolInfo: cds.ProtocolInfo{MimeType: types.NewMIME("image/jpeg")},
+	}
+	res.ProtocolInfo.Set(cds.DLNAProfileName, JPEGProfile)
+	res.ProtocolInfo.Set(cds.DLNAConversion, dlna.Converted)
+	res.ProtocolInfo.Set(cds.DLNAFlags, dlna.InteractiveFlags.String())
+	obj.AddResource(res)
+	return true
+}
+
+func (p *Processor) profile(obj *cds.Object, ctx context.Context) string {
+	switch obj.MimeType.Type {
+	case "image":
+		switch obj.MimeType.Subtype {
+		case "png", "gif":
+			return PNGProfile
+		case "jpeg":
+			return JPEGProfile
+		}
+	case "video":
+		if p.binPath != "" {
+			return JPEGProfile
+		}
+	case "audio":
+		if p.binPath != "" && p.prober != nil {
+			if stream, err := p.prober.CoverStream(obj.FilePath, ctx); err == nil && stream >= 0 {
+				return JPEGProfile
+			}
+		}
+	}
+	return ""
+}
+
+// URLSpec returns the URL specification of the thumbnail of an object
+func URLSpec(id filesystem.ID) *adi_http.URLSpec {
+	return adi_http.NewURLSpec(ThumbnailRoute, cds.RouteObjectIDParameter, id.String())
+}
+
+// CoverURLSpec returns the URL specification of the embedded cover art of an audio item
+func CoverURLSpec(id filesystem.ID) *adi_http.URLSpec {
+	return adi_http.NewURLSpec(CoverRoute, cds.RouteObjectIDParameter, id.String())
+}
+
+// CoverHandler serves the embedded cover art of the audio items, at its original size
+func (p *Processor) CoverHandler() http.Handler {
+	return &cds.DirectoryHandler{Directory: p.Directory, Handler: coverHandler{p}}
+}
+
+// coverProfile returns the DLNA profile of the embedded cover art, e.g. "JPEG_LRG"
+func coverProfile(s *ffprobe.Stream) string {
+	return dlna.MediaInfo{Container: "image2", VideoCodec: s.CodecName, Width: s.Width, Height: s.Height}.ProfileName()
+}
+
+type coverHandler struct {
+	*Processor
+}
+
+func (h coverHandler) ServeObject(w http.ResponseWriter, r *http.Request, obj *cds.Object) {
+	var s *ffprobe.Stream
+	if obj.MimeType.Type == "audio" && h.binPath != "" && h.prober != nil {
+		s, _ = h.prober.Cover(obj.FilePath, r.Context())
+	}
+	if s == nil || coverTypes[s.CodecName] == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	// The picture is copied as is
+	data, err := h.runFFmpeg(r.Context(), "-i", obj.FilePath, "-map", "0:"+strconv.Itoa(s.Index), "-c", "copy", "-frames:v", "1", "-f", "image2", "pipe:1")
+	if r.Context().Err() != nil {
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context(), h.l).Warnf("cannot extract the cover art of %s: %s", obj.FilePath, err)
+		http.Error(w, "Cannot extract the cover art", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", coverTypes[s.CodecName])
+	http.ServeContent(w, r, "", obj.ModTime, bytes.NewReader(data))
+}
+
+// Invalidate removes the thumbnails of the given files from the cache.
+func (p *Processor) Invalidate(paths ...string) {
+	for _, path := range paths {
+		p.m.Delete(path)
+	}
+}
+
+func (p *Processor) ServeObject(w http.ResponseWriter, r *http.Request, obj *cds.Object) {
+	if obj.IsContainer() || p.profile(obj, r.Context()) == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	var data interface{}
+	err := context.Canceled
+	// A generation cancelled by the other waiters is retried once
+	for try := 0; try < 2 && err == context.Canceled; try++ {
+		data, err = p.get(obj.FilePath, r.Context())
+		if r.Context().Err() != nil {
+			return
+		}
+	}
+	if err != nil {
+		http.Error(w, "Cannot generate the thumbnail", http.StatusInternalServerError)
+		return
+	}
+	t := data.(*Thumbnail)
+	w.Header().Set("Content-Type", t.MimeType)
+	http.ServeContent(w, r, "", t.ModTime, bytes.NewReader(t.Data))
+}
+
+// get waits for the thumbnail of a file. ffmpeg is killed once all the clients waiting for it have disconnected.
+func (p *Processor) get(filePath string, ctx context.Context) (interface{}, error) {
+	p.join(filePath)
+	defer p.leave(filePath)
+	select {
+	case res := <-p.m.Get(filePath):
+		return res.Value()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *Processor) join(filePath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, found := p.generations[filePath]
+	if !found {
+		g = &generation{}
+		g.ctx, g.cancel = context.WithTimeout(context.Background(), GenerationTimeout)
+		p.generations[filePath] = g
+	}
+	g.waiters++
+}
+
+func (p *Processor) leave(filePath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g := p.generations[filePath]
+	if g.waiters--; g.waiters == 0 {
+		g.cancel()
+		delete(p.generations, filePath)
+	}
+}
+
+// generationContext returns the context of the generation of the thumbnail of a file
+func (p *Processor) generationContext(filePath string) context.Context {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if g, found := p.generations[filePath]; found {
+		return g.ctx
+	}
+	return context.Background()
+}
+
+func (p *Processor) loader(key interface{}) (value interface{}, err error) {
+	filePath := key.(string)
+	ctx := p.generationContext(filePath)
+	fi, err := filesystem.ItemFromPath(filePath)
+	if err != nil {
+		return
+	}
+	typ, err := filetype.MatchFile(filePath)
+	if err != nil {
+		return
+	}
+
+	t := &Thumbnail{FileItem: fi}
+	switch typ.MIME.Type {
+	case "image":
+		t.MimeType, t.Data, err = p.downsize(filePath, typ.MIME.Subtype)
+	case "video":
+		t.MimeType, t.Data, err = p.extractFrame(filePath, ctx)
+	case "audio":
+		t.MimeType, t.Data, err = p.extractCover(filePath, ctx)
+	default:
+		err = fmt.Errorf("no thumbnail for %s files", typ.MIME.Value)
+	}
+	if err != nil && ctx.Err() != nil {
+		// Interrupted, not cached as a failure
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate the thumbnail of %s: %s", filePath, err)
+	}
+	p.l.Debugf("generated %s thumbnail of %s, %d bytes", t.MimeType, filePath, len(t.Data))
+	return t, nil
+}
+
+func (p *Processor) downsize(filePath, subtype string) (mimeType string, data []byte, err error) {
+	fh, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+	if fi, err := fh.Stat(); err == nil && fi.Size() > maxImageSize {
+		return "", nil, fmt.Errorf("image too large: %d bytes", fi.Size())
+	}
+
+	// Check the dimensions before allocating the pixels
+	cfg, _, err := image.DecodeConfig(fh)
+	if err != nil {
+		return
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > maxImagePixels {
+		return "", nil, fmt.Errorf("image too large: %dx%d pixels", cfg.Width, cfg.Height)
+	}
+	if _, err = fh.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	src, _, err := image.Decode(fh)
+	if err != nil {
+		return
+	}
+	w, h := fit(src.Bounds().Dx(), src.Bounds().Dy(), MaxSize)
+	dst := downscale(src, w, h)
+
+	var buf bytes.Buffer
+	if subtype == "png" || subtype == "gif" {
+		mimeType, err = "image/png", png.Encode(&buf, dst)
+	} else {
+		mimeType, err = "image/jpeg", jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	}
+	return mimeType, buf.Bytes(), err
+}
+
+func (p *Processor) extractFrame(filePath string, ctx context.Context) (mimeType string, data []byte, err error) {
+	if p.binPath == "" {
+		err = fmt.Errorf("ffmpeg is not available")
+		return
+	}
+
+	// Skip the beginning, which is often black
+	offset := 10 * time.Second
+	if p.prober != nil {
+		if duration, err := p.prober.Duration(filePath, ctx); err == nil && duration > 0 {
+			offset = duration / 10
+		}
+	}
+
+	scale := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", MaxSize, MaxSize)
+	ss := strconv.FormatFloat(offset.Seconds(), 'f', 3, 64)
+	data, err = p.runFFmpeg(ctx, "-ss", ss, "-i", filePath, "-frames:v", "1", "-vf", scale, "-f", "image2", "-c:v", "mjpeg", "pipe:1")
+	if err == nil && len(data) == 0 {
+		// The video is shorter than the offset
+		data, err = p.runFFmpeg(ctx, "-i", filePath, "-frames:v", "1", "-vf", scale, "-f", "image2", "-c:v", "mjpeg", "pipe:1")
+	}
+	return "image/jpeg", data, err
+}
+
+func (p *Processor) extractCover(filePath string, ctx context.Context) (mimeType string, data []byte, err error) {
+	if p.binPath == "" || p.prober == nil {
+		err = fmt.Errorf("ffmpeg or ffprobe is not available")
+		return
+	}
+	stream, err := p.prober.CoverStream(filePath, ctx)
+	if err != nil {
+		return
+	}
+	if stream < 0 {
+		err = fmt.Errorf("no embedded cover art")
+		return
+	}
+	scale := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", MaxSize, MaxSize)
+	data, err = p.runFFmpeg(ctx, "-i", filePath, "-map", "0:"+strconv.Itoa(stream), "-frames:v", "1", "-vf", scale, "-f", "image2", "-c:v", "mjpeg", "pipe:1")
+	return "image/jpeg", data, err
+}
+
+func (p *Processor) runFFmpeg(ctx context.Context, args ...string) ([]byte, error) {
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// CommandContext kills ffmpeg when the context is done
+	cmd := exec.CommandContext(ctx, p.binPath, append([]string{"-hide_banner", "-nostdin", "-v", "error"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	p.l.Debugf("running %v", cmd.Args)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s\n%s", err, stderr.String())
+	}
+	return output, nil
+}
@@ -0,0 +1,73 @@
+package thumbnail
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/processor/ffprobe"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+func TestDownsizeTooManyPixels(t *testing.T) {
+	fh, err := ioutil.TempFile("", "dms-thumbnail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fh.Name())
+	// A GIF header announcing a 65535x65535 image
+	fh.Write([]byte("GIF89a\xff\xff\xff\xff\x00\x00\x00"))
+	fh.Close()
+
+	p := &Processor{}
+	if _, _, err := p.downsize(fh.Name(), "gif"); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("expected the image to be rejected, got %v", err)
+	}
+}
+
+func TestGenerationContext(t *testing.T) {
+	p := &Processor{generations: make(map[string]*generation)}
+	p.join("a.mkv")
+	p.join("a.mkv")
+	ctx := p.generationContext("a.mkv")
+
+	// The first client disconnects
+	p.leave("a.mkv")
+	if ctx.Err() != nil {
+		t.Fatal("expected the generation to go on while a client waits for it")
+	}
+	p.leave("a.mkv")
+	if ctx.Err() == nil {
+		t.Error("expected the generation to be cancelled once all the clients are gone")
+	}
+	if len(p.generations) != 0 {
+		t.Errorf("expected the generation to be forgotten, got %v", p.generations)
+	}
+}
+
+func TestCoverProfile(t *testing.T) {
+	var data = map[string]ffprobe.Stream{
+		"JPEG_LRG": {CodecName: "mjpeg", Width: 1400, Height: 1400},
+		"JPEG_SM":  {CodecName: "mjpeg", Width: 400, Height: 400},
+		"PNG_LRG":  {CodecName: "png", Width: 1000, Height: 1000},
+	}
+	for expected, s := range data {
+		if actual := coverProfile(&s); actual != expected {
+			t.Errorf("coverProfile(%s %dx%d), expected %q, got %q", s.CodecName, s.Width, s.Height, expected, actual)
+		}
+	}
+}
+
+func TestCoverNotFound(t *testing.T) {
+	h := coverHandler{&Processor{}}
+	w := httptest.NewRecorder()
+	obj := &cds.Object{MimeType: types.NewMIME("audio/mpeg")}
+	h.ServeObject(w, httptest.NewRequest("GET", "/covers/song.mp3", nil), obj)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("without ffmpeg, expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,36 @@
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	var data = map[[2]int][2]int{
+		{100, 50}:    {100, 50},
+		{1600, 1200}: {160, 120},
+		{1200, 1600}: {120, 160},
+		{4000, 10}:   {160, 1},
+	}
+	for input, expected := range data {
+		if w, h := fit(input[0], input[1], 160); w != expected[0] || h != expected[1] {
+			t.Errorf("fit(%d, %d, 160), expected %v, got [%d %d]", input[0], input[1], expected, w, h)
+		}
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.SetRGBA(x, 0, color.RGBA{255, 0, 0, 255})
+		src.SetRGBA(x, 1, color.RGBA{0, 0, 255, 255})
+	}
+	dst := downscale(src, 2, 1)
+	if b := dst.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("downscale, expected 2x1, got %dx%d", b.Dx(), b.Dy())
+	}
+	if actual, expected := dst.RGBAAt(1, 0), (color.RGBA{127, 0, 127, 255}); actual != expected {
+		t.Errorf("downscale, expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,263 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/dlna"
+	"github.com/Adirelle/dms/pkg/processor/ffprobe"
+	"github.com/Adirelle/dms/pkg/renderer"
+	adi_http "github.com/Adirelle/go-libs/http"
+	"github.com/Adirelle/go-libs/logging"
+	"github.com/gorilla/mux"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+const (
+	TranscodeRoute        = "transcode"
+	RouteProfileParameter = "profile"
+	RouteProfileTemplate  = "{profile:[^/]+}"
+
+	// maxStderr is the maximum amount of ffmpeg error output kept for logging
+	maxStderr = 4096
+)
+
+type Config struct {
+	BinPath  string    `json:"binPath"`
+	Limit    uint      `json:"limit"`
+	Profiles []Profile `json:"profiles"`
+}
+
+// remuxFormats lists the ffmpeg output options used to remux files of the given MIME types
+// when time seeking in the original files.
+var remuxFormats = map[string][]string{
+	"audio/mpeg":       {"-f", "mp3"},
+	"audio/m4a":        {"-f", "mp4", "-movflags", "frag_keyframe+empty_moov"},
+	"audio/ogg":        {"-f", "ogg"},
+	"audio/x-flac":     {"-f", "flac"},
+	"audio/x-wav":      {"-f", "wav"},
+	"video/mp4":        {"-f", "mp4", "-movflags", "frag_keyframe+empty_moov"},
+	"video/x-m4v":      {"-f", "mp4", "-movflags", "frag_keyframe+empty_moov"},
+	"video/quicktime":  {"-f", "mov", "-movflags", "frag_keyframe+empty_moov"},
+	"video/x-matroska": {"-f", "matroska"},
+	"video/webm":       {"-f", "webm"},
+	"video/x-msvideo":  {"-f", "avi"},
+	"video/mpeg":       {"-f", "mpeg"},
+	"video/x-flv":      {"-f", "flv"},
+}
+
+// Processor advertises a resource per applicable transcoding profile and streams the output of ffmpeg.
+// It also implements cds.TimeSeeker for the original files, if the durations can be probed.
+type Processor struct {
+	cds.DirectoryHandler
+	binPath  string
+	profiles []Profile
+	prober   *ffprobe.Processor
+	slots    chan struct{}
+	l        logging.Logger
+}
+
+func (Processor) String() string {
+	return "TranscodeProcessor"
+}
+
+// NewProcessor creates a Processor. prober can be nil, in which case time seeking is disabled.
+func NewProcessor(c Config, d cds.ContentDirectory, prober *ffprobe.Processor, l logging.Logger) (p *Processor, err error) {
+	realPath, err := exec.LookPath(c.BinPath)
+	if err != nil {
+		return
+	}
+	p = &Processor{
+		binPath:  realPath,
+		profiles: c.Profiles,
+		prober:   prober,
+		slots:    make(chan struct{}, c.Limit),
+		l:        l,
+	}
+	if len(p.profiles) == 0 {
+		p.profiles = DefaultProfiles
+	}
+	p.DirectoryHandler = cds.DirectoryHandler{Directory: d, Handler: p}
+	return
+}
+
+func (p *Processor) Process(obj *cds.Object, _ context.Context) {
+	if obj.IsContainer() {
+		return
+	}
+	for i := range p.profiles {
+		prf := &p.profiles[i]
+		if !prf.AppliesTo(obj.MimeType) || prf.MimeType == obj.MimeType.Value {
+			continue
+		}
+		res := cds.Resource{
+			URL:          URLSpec(obj, prf),
+			ProtocolInfo: cds.ProtocolInfo{MimeType: types.NewMIME(prf.MimeType)},
+			FilePath:     obj.FilePath,
+		}
+		if prf.DLNAProfile != "" {
+			res.ProtocolInfo.Set(cds.DLNAProfileName, prf.DLNAProfile)
+		}
+		if p.prober != nil {
+			res.ProtocolInfo.Set(cds.DLNAOperation, dlna.OpTimeSeek)
+		} else {
+			res.ProtocolInfo.Set(cds.DLNAOperation, dlna.OpNone)
+		}
+		res.ProtocolInfo.Set(cds.DLNAConversion, dlna.Converted)
+		res.ProtocolInfo.Set(cds.DLNAFlags, dlna.StreamingFlags.String())
+		obj.AddResource(res)
+	}
+}
+
+// URLSpec returns the URL specification of the transcoded stream
+func URLSpec(obj *cds.Object, prf *Profile) *adi_http.URLSpec {
+	return adi_http.NewURLSpec(
+		TranscodeRoute,
+		RouteProfileParameter, prf.Name,
+		cds.RouteObjectIDParameter, obj.ID.String(),
+	)
+}
+
+func (p *Processor) profile(name string) *Profile {
+	for i := range p.profiles {
+		if p.profiles[i].Name == name {
+			return &p.profiles[i]
+		}
+	}
+	return nil
+}
+
+// ServeObject streams the output of ffmpeg, honouring the TimeSeekRange.dlna.org header.
+func (p *Processor) ServeObject(w http.ResponseWriter, r *http.Request, obj *cds.Object) {
+	prf := p.profile(mux.Vars(r)[RouteProfileParameter])
+	if prf == nil || obj.IsContainer() || !prf.AppliesTo(obj.MimeType) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	var rng *dlna.NPTRange
+	if h := r.Header.Get(dlna.TimeSeekRangeHeader); h != "" {
+		if p.prober == nil {
+			http.Error(w, "Time seeking is not supported", http.StatusNotAcceptable)
+			return
+		}
+		parsed, err := dlna.ParseNPTRange(h)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		rng = &parsed
+	}
+
+	p.serve(w, r, obj, prf.Name, prf.MimeType, prf.Args, rng)
+}
+
+// CanTimeSeek implements cds.TimeSeeker
+func (p *Processor) CanTimeSeek(obj *cds.Object) bool {
+	_, found := remuxFormats[obj.MimeType.Value]
+	return p.prober != nil && found
+}
+
+// ServeTimeRange implements cds.TimeSeeker by remuxing the original file from the requested position.
+func (p *Processor) ServeTimeRange(w http.ResponseWriter, r *http.Request, obj *cds.Object, rng dlna.NPTRange) {
+	args := append([]string{"-map", "0", "-c", "copy"}, remuxFormats[obj.MimeType.Value]...)
+	p.serve(w, r, obj, "remux", obj.MimeType.Value, args, &rng)
+}
+
+// serve runs ffmpeg and streams its output. ffmpeg is killed as soon as the client disconnects.
+func (p *Processor) serve(w http.ResponseWriter, r *http.Request, obj *cds.Object, name, mimeType string, args []string, rng *dlna.NPTRange) {
+	h := w.Header()
+	if rng != nil {
+		total, err := p.prober.Duration(obj.FilePath, r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if *rng, err = rng.Resolve(total); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		h.Set(dlna.TimeSeekRangeHeader, rng.Header(total))
+	}
+	h.Set("Content-Type", mimeType)
+	h.Set(dlna.TransferModeHeader, "Streaming")
+	renderer.FromContext(r.Context()).SetHeaders(h)
+	if r.Method == "HEAD" {
+		return
+	}
+
+	if cap(p.slots) > 0 {
+		select {
+		case p.slots <- struct{}{}:
+			defer func() { <-p.slots }()
+		default:
+			http.Error(w, "Too many transcoding processes", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	l := logging.FromContext(r.Context(), p.l).With("path", obj.FilePath, "profile", name)
+	if err := p.run(r.Context(), obj.FilePath, args, rng, w, l); err != nil {
+		l.Warn(err)
+	}
+}
+
+func (p *Processor) run(ctx context.Context, path string, outputArgs []string, rng *dlna.NPTRange, w http.ResponseWriter, l logging.Logger) error {
+	// CommandContext kills ffmpeg when the request context is done, i.e. when the client disconnects
+	cmd := exec.CommandContext(ctx, p.binPath, ffmpegArgs(path, outputArgs, rng)...)
+	stderr := &limitedBuffer{max: maxStderr}
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+
+	l.Debugf("running %v", cmd.Args)
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		l.Debug("client disconnected")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed: %s\n%s", err, stderr.String())
+	}
+	return nil
+}
+
+// ffmpegArgs builds the arguments of ffmpeg, seeking to the start of rng and limiting the output to its duration
+func ffmpegArgs(path string, outputArgs []string, rng *dlna.NPTRange) []string {
+	args := []string{"-hide_banner", "-nostdin", "-v", "error"}
+	if rng != nil && rng.Start != 0 {
+		args = append(args, "-ss", seconds(rng.Start))
+	}
+	args = append(args, "-i", path)
+	if rng != nil && rng.Duration() != 0 {
+		args = append(args, "-t", seconds(rng.Duration()))
+	}
+	args = append(args, outputArgs...)
+	return append(args, "pipe:1")
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// limitedBuffer keeps the first max bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
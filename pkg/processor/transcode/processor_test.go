@@ -0,0 +1,112 @@
+package transcode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/dms/pkg/cds"
+	"github.com/Adirelle/dms/pkg/dlna"
+	"github.com/Adirelle/dms/pkg/filesystem"
+	"github.com/Adirelle/go-libs/logging"
+	"gopkg.in/h2non/filetype.v1/types"
+)
+
+func TestProcess(t *testing.T) {
+	var data = []struct {
+		mimeType string
+		profiles []string
+	}{
+		{"video/x-matroska", []string{"video/mp2t"}},
+		// Not transcoded to its own format
+		{"audio/mpeg", []string{"audio/L16;rate=44100;channels=2"}},
+		{"audio/x-flac", []string{"audio/mpeg", "audio/L16;rate=44100;channels=2"}},
+		{"image/jpeg", nil},
+	}
+	p := &Processor{profiles: DefaultProfiles}
+	for _, d := range data {
+		obj := &cds.Object{Object: filesystem.Object{ID: "/file"}, MimeType: types.NewMIME(d.mimeType)}
+		p.Process(obj, context.Background())
+		var actual []string
+		for _, res := range obj.Resources {
+			actual = append(actual, res.ProtocolInfo.MimeType.Value)
+		}
+		if !reflect.DeepEqual(actual, d.profiles) {
+			t.Errorf("Process(%s), expected %v, got %v", d.mimeType, d.profiles, actual)
+		}
+	}
+}
+
+func TestProtocolInfo(t *testing.T) {
+	obj := &cds.Object{Object: filesystem.Object{ID: "/movie.mkv"}, MimeType: types.NewMIME("video/x-matroska")}
+	p := &Processor{profiles: DefaultProfiles}
+	p.Process(obj, context.Background())
+	if len(obj.Resources) != 1 {
+		t.Fatalf("expected one resource, got %d", len(obj.Resources))
+	}
+	info := obj.Resources[0].ProtocolInfo
+	expected := map[cds.AddInfoKey]string{
+		cds.DLNAProfileName: "AVC_TS_MP_HD_AAC_ISO",
+		// Without prober, time seeking is disabled
+		cds.DLNAOperation:  dlna.OpNone,
+		cds.DLNAConversion: dlna.Converted,
+		cds.DLNAFlags:      dlna.StreamingFlags.String(),
+	}
+	for key, value := range expected {
+		if actual := info.Get(key); actual != value {
+			t.Errorf("%s, expected %q, got %q", key, value, actual)
+		}
+	}
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	output := []string{"-f", "mp3"}
+	var data = []struct {
+		rng      *dlna.NPTRange
+		expected []string
+	}{
+		{nil, []string{"-i", "in.flac", "-f", "mp3", "pipe:1"}},
+		{&dlna.NPTRange{Start: 0}, []string{"-i", "in.flac", "-f", "mp3", "pipe:1"}},
+		{&dlna.NPTRange{Start: 90 * time.Second}, []string{"-ss", "90.000", "-i", "in.flac", "-f", "mp3", "pipe:1"}},
+		{&dlna.NPTRange{Start: 10 * time.Second, End: 12500 * time.Millisecond}, []string{"-ss", "10.000", "-i", "in.flac", "-t", "2.500", "-f", "mp3", "pipe:1"}},
+	}
+	for _, d := range data {
+		actual := ffmpegArgs("in.flac", output, d.rng)
+		if expected := append([]string{"-hide_banner", "-nostdin", "-v", "error"}, d.expected...); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("ffmpegArgs(%+v), expected %q, got %q", d.rng, expected, actual)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	binPath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip(err)
+	}
+	obj := &cds.Object{Object: filesystem.Object{ID: "/song.flac"}, MimeType: types.NewMIME("audio/x-flac")}
+	serve := func(p *Processor) int {
+		w := httptest.NewRecorder()
+		p.serve(w, httptest.NewRequest("GET", "/", nil), obj, "mp3", "audio/mpeg", nil, nil)
+		return w.Code
+	}
+
+	// No limit
+	p := &Processor{binPath: binPath, slots: make(chan struct{}, 0), l: logging.NewTesting(t)}
+	if code := serve(p); code != http.StatusOK {
+		t.Errorf("without limit, expected %d, got %d", http.StatusOK, code)
+	}
+
+	p.slots = make(chan struct{}, 1)
+	p.slots <- struct{}{}
+	if code := serve(p); code != http.StatusServiceUnavailable {
+		t.Errorf("with all the slots in use, expected %d, got %d", http.StatusServiceUnavailable, code)
+	}
+	<-p.slots
+	if code := serve(p); code != http.StatusOK || len(p.slots) != 0 {
+		t.Errorf("with a free slot, expected %d, got %d and %d slots in use", http.StatusOK, code, len(p.slots))
+	}
+}
@@ -0,0 +1,57 @@
+package transcode
+
+import "gopkg.in/h2non/filetype.v1/types"
+
+// Profile describes one output format of ffmpeg
+type Profile struct {
+	// Name identifies the profile in URLs
+	Name string `json:"name"`
+	// MimeType of the output
+	MimeType string `json:"mimeType"`
+	// DLNAProfile is the DLNA profile name of the output, if any
+	DLNAProfile string `json:"dlnaProfile,omitempty"`
+	// MediaTypes lists the types of media the profile applies to, e.g. "audio" or "video"
+	MediaTypes []string `json:"mediaTypes"`
+	// Args are the ffmpeg output options
+	Args []string `json:"args"`
+}
+
+// DefaultProfiles are used when none are configured
+var DefaultProfiles = []Profile{
+	{
+		Name:        "mpegts",
+		MimeType:    "video/mp2t",
+		DLNAProfile: "AVC_TS_MP_HD_AAC_ISO", // Stereo AAC, see "-ac 2"
+		MediaTypes:  []string{"video"},
+		Args: []string{
+			"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main", "-level", "4.0", "-pix_fmt", "yuv420p",
+			"-vf", "scale='min(1920,iw)':-2",
+			"-c:a", "aac", "-b:a", "192k", "-ac", "2",
+			"-f", "mpegts",
+		},
+	},
+	{
+		Name:        "mp3",
+		MimeType:    "audio/mpeg",
+		DLNAProfile: "MP3",
+		MediaTypes:  []string{"audio"},
+		Args:        []string{"-vn", "-c:a", "libmp3lame", "-b:a", "320k", "-ar", "44100", "-f", "mp3"},
+	},
+	{
+		Name:        "lpcm",
+		MimeType:    "audio/L16;rate=44100;channels=2",
+		DLNAProfile: "LPCM",
+		MediaTypes:  []string{"audio"},
+		Args:        []string{"-vn", "-c:a", "pcm_s16be", "-ar", "44100", "-ac", "2", "-f", "s16be"},
+	},
+}
+
+// AppliesTo returns true if the profile can be used to transcode media of the given type
+func (p *Profile) AppliesTo(mimeType types.MIME) bool {
+	for _, t := range p.MediaTypes {
+		if t == mimeType.Type {
+			return true
+		}
+	}
+	return false
+}
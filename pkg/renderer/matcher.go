@@ -0,0 +1,69 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+// For typing of context variables
+type profileKeyType int
+
+const profileKey = profileKeyType(1)
+
+// Matcher selects the renderer profile of the requests
+type Matcher struct {
+	profiles []*Profile
+}
+
+// NewMatcher compiles the profiles. The first matching profile is used.
+func NewMatcher(profiles []Profile) (*Matcher, error) {
+	m := &Matcher{profiles: make([]*Profile, len(profiles))}
+	for i := range profiles {
+		p := profiles[i]
+		re, err := regexp.Compile(p.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match expression for renderer profile %q: %s", p.Name, err)
+		}
+		p.re = re
+		m.profiles[i] = &p
+	}
+	return m, nil
+}
+
+// Match returns the profile of the renderer sending the request, or Generic
+func (m *Matcher) Match(r *http.Request) *Profile {
+	for _, p := range m.profiles {
+		if p.matches(r) {
+			return p
+		}
+	}
+	return Generic
+}
+
+// Middleware stores the renderer profile into the request context
+func (m *Matcher) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := m.Match(r)
+		if p != Generic {
+			logging.MustFromContext(r.Context()).Debugf("renderer profile: %s", p.Name)
+		}
+		next.ServeHTTP(w, r.WithContext(WithProfile(r.Context(), p)))
+	})
+}
+
+// WithProfile returns a new context holding the profile
+func WithProfile(ctx context.Context, p *Profile) context.Context {
+	return context.WithValue(ctx, profileKey, p)
+}
+
+// FromContext returns the renderer profile stored in the context, or Generic
+func FromContext(ctx context.Context) *Profile {
+	if p, ok := ctx.Value(profileKey).(*Profile); ok {
+		return p
+	}
+	return Generic
+}
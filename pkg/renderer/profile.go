@@ -0,0 +1,154 @@
+package renderer
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Adirelle/dms/pkg/didl_lite"
+)
+
+const (
+	// GetCaptionInfoHeader is sent by Samsung devices to request the location of the subtitles
+	GetCaptionInfoHeader = "getCaptionInfo.sec"
+	// CaptionInfoHeader is the response header holding the URL of the subtitles
+	CaptionInfoHeader = "CaptionInfo.sec"
+)
+
+// Profile describes the quirks of a family of renderers
+type Profile struct {
+	Name string `json:"name"`
+	// Match is a regular expression matched against the User-Agent, X-AV-Client-Info and X-AV-Physical-Unit-Info headers
+	Match string `json:"match"`
+	// MimeTypes maps our MIME types to the ones expected by the renderer
+	MimeTypes map[string]string `json:"mimeTypes,omitempty"`
+	// PlainProtocolInfo removes the additional info (DLNA.ORG_*) from the protocolInfo
+	PlainProtocolInfo bool `json:"plainProtocolInfo,omitempty"`
+	// HiddenProperties are removed from DIDL-Lite, e.g. "upnp:albumArtURI" or "res@bitrate"
+	HiddenProperties []string `json:"hiddenProperties,omitempty"`
+	// Headers are added to the responses of the file server
+	Headers map[string]string `json:"headers,omitempty"`
+	// ContainerAliases maps the container IDs requested by the renderer to our own IDs
+	ContainerAliases map[string]string `json:"containerAliases,omitempty"`
+	// CaptionInfoHeader enables the CaptionInfo.sec response header
+	CaptionInfoHeader bool `json:"captionInfoHeader,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Generic is the profile used for unknown renderers
+var Generic = &Profile{Name: "generic"}
+
+// DefaultProfiles are used when none are configured
+var DefaultProfiles = []Profile{
+	{
+		Name:              "samsung",
+		Match:             `(?i)samsung|SEC_HHP`,
+		CaptionInfoHeader: true,
+		MimeTypes: map[string]string{
+			"text/srt": "smi/caption",
+		},
+	},
+	{
+		Name:  "sony",
+		Match: `(?i)sony|bravia|playstation`,
+		MimeTypes: map[string]string{
+			"video/x-matroska": "video/x-mkv",
+			"video/x-msvideo":  "video/avi",
+		},
+	},
+	{
+		Name:  "xbox",
+		Match: `(?i)xbox`,
+		MimeTypes: map[string]string{
+			"video/x-msvideo": "video/avi",
+		},
+		// The Xbox 360 browses and searches fixed containers, see the Windows Media Connect specs
+		ContainerAliases: map[string]string{
+			"1":  "0",
+			"4":  "0",
+			"5":  "0",
+			"6":  "0",
+			"7":  "0",
+			"15": "0",
+			"16": "0",
+		},
+	},
+}
+
+var matchedHeaders = []string{"User-Agent", "X-AV-Client-Info", "X-AV-Physical-Unit-Info"}
+
+func (p *Profile) matches(r *http.Request) bool {
+	for _, name := range matchedHeaders {
+		if v := r.Header.Get(name); v != "" && p.re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// MimeType returns the MIME type the renderer expects
+func (p *Profile) MimeType(mimeType string) string {
+	if alias, found := p.MimeTypes[mimeType]; found {
+		return alias
+	}
+	return mimeType
+}
+
+// ContainerID translates the ID of a container requested by the renderer
+func (p *Profile) ContainerID(id string) string {
+	if alias, found := p.ContainerAliases[id]; found {
+		return alias
+	}
+	return id
+}
+
+// SetHeaders adds the extra headers of the profile to the response headers,
+// and rewrites the Content-Type.
+func (p *Profile) SetHeaders(h http.Header) {
+	if ct := h.Get("Content-Type"); ct != "" {
+		h.Set("Content-Type", p.MimeType(ct))
+	}
+	for name, value := range p.Headers {
+		h.Set(name, value)
+	}
+}
+
+// RewriteDIDLLite applies the quirks to a DIDL-Lite object
+func (p *Profile) RewriteDIDLLite(obj didl_lite.Object) {
+	var cm *didl_lite.Common
+	switch o := obj.(type) {
+	case *didl_lite.Item:
+		cm = &o.Common
+	case *didl_lite.Container:
+		cm = &o.Common
+	default:
+		return
+	}
+	for _, name := range p.HiddenProperties {
+		if !strings.HasPrefix(name, didl_lite.TagResource+"@") {
+			cm.Tags.Delete(name)
+		}
+	}
+	for i := range cm.Resources {
+		p.rewriteResource(&cm.Resources[i])
+	}
+}
+
+func (p *Profile) rewriteResource(res *didl_lite.Resource) {
+	for _, name := range p.HiddenProperties {
+		if strings.HasPrefix(name, didl_lite.TagResource+"@") {
+			res.DeleteTag(strings.TrimPrefix(name, didl_lite.TagResource+"@"))
+		}
+	}
+	// protocol:network:contentFormat:additionalInfo
+	parts := strings.SplitN(res.ProtocolInfo, ":", 4)
+	if len(parts) != 4 {
+		return
+	}
+	parts[2] = p.MimeType(parts[2])
+	if p.PlainProtocolInfo {
+		parts[3] = "*"
+	}
+	res.ProtocolInfo = strings.Join(parts, ":")
+}
@@ -0,0 +1,67 @@
+package renderer
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Adirelle/dms/pkg/didl_lite"
+)
+
+func TestMatcher(t *testing.T) {
+	m, err := NewMatcher(DefaultProfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data = map[string]string{
+		"User-Agent: Xbox/2.0.4548.0 UPnP/1.0 Xbox/2.0.4548.0":         "xbox",
+		"X-AV-Client-Info: av=5.0; cn=\"Sony Corporation\"; mn=BRAVIA": "sony",
+		"User-Agent: VLC/3.0.8 LibVLC/3.0.8":                           "generic",
+	}
+	for header, expected := range data {
+		r := httptest.NewRequest("GET", "/", nil)
+		parts := strings.SplitN(header, ": ", 2)
+		r.Header.Set(parts[0], parts[1])
+		if actual := m.Match(r).Name; actual != expected {
+			t.Errorf("Match(%q), expected %q, got %q", header, expected, actual)
+		}
+	}
+
+	if _, err := NewMatcher([]Profile{{Name: "broken", Match: "("}}); err == nil {
+		t.Error("NewMatcher should reject invalid expressions")
+	}
+}
+
+func TestRewriteDIDLLite(t *testing.T) {
+	p := &Profile{
+		MimeTypes:         map[string]string{"video/x-matroska": "video/x-mkv"},
+		PlainProtocolInfo: true,
+		HiddenProperties:  []string{"upnp:albumArtURI", "res@bitrate"},
+	}
+	item := &didl_lite.Item{}
+	item.Tags.Set(didl_lite.TagAlbumArtURI, "http://example.com/cover.jpg")
+	item.Tags.Set(didl_lite.TagArtist, "Artist")
+	res := didl_lite.Resource{ProtocolInfo: "http-get:*:video/x-matroska:DLNA.ORG_OP=01"}
+	res.SetTag(didl_lite.ResBitrate, "1000")
+	res.SetTag(didl_lite.ResSize, "2000")
+	item.AddResources(res)
+
+	p.RewriteDIDLLite(item)
+
+	if _, found := item.Tags[didl_lite.TagAlbumArtURI]; found {
+		t.Error("RewriteDIDLLite should have removed upnp:albumArtURI")
+	}
+	if _, found := item.Tags[didl_lite.TagArtist]; !found {
+		t.Error("RewriteDIDLLite should have kept upnp:artist")
+	}
+	tags := item.Resources[0].Tags()
+	if _, found := tags[didl_lite.ResBitrate]; found {
+		t.Error("RewriteDIDLLite should have removed res@bitrate")
+	}
+	if _, found := tags[didl_lite.ResSize]; !found {
+		t.Error("RewriteDIDLLite should have kept res@size")
+	}
+	if actual, expected := item.Resources[0].ProtocolInfo, "http-get:*:video/x-mkv:*"; actual != expected {
+		t.Errorf("RewriteDIDLLite, expected protocolInfo %q, got %q", expected, actual)
+	}
+}
@@ -54,7 +54,7 @@ func (s *Server) ServeObject(w http.ResponseWriter, r *http.Request, o *cds.Obje
 
 func (s *Server) getResponse(o *cds.Object, ctx context.Context) (data response, err error) {
 	urlGen := adi_http.URLGeneratorFromContext(ctx)
-	data.Object, err = o.MarshalDIDLLite(urlGen)
+	data.Object, err = o.MarshalDIDLLite(urlGen, didl_lite.AllProperties)
 	if err != nil {
 		return
 	}
@@ -64,7 +64,7 @@ func (s *Server) getResponse(o *cds.Object, ctx context.Context) (data response,
 	}
 	for _, child := range children {
 		var obj didl_lite.Object
-		obj, err = child.MarshalDIDLLite(urlGen)
+		obj, err = child.MarshalDIDLLite(urlGen, didl_lite.AllProperties)
 		if err != nil {
 			return
 		}
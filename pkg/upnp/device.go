@@ -22,6 +22,7 @@ const (
 	DDDRoute     = "ddd"
 	ControlRoute = "control"
 	SCPDRoute    = "scpd"
+	EventRoute   = "event"
 	IconRoute    = "icon"
 )
 
@@ -122,6 +123,15 @@ func NewDevice(spec DeviceSpec, router *mux.Router) (ret Device, err error) {
 		Name(SCPDRoute).
 		HandlerFunc(dev.describeService).
 		GetError()
+	if err != nil {
+		return
+	}
+
+	err = router.Methods("SUBSCRIBE", "UNSUBSCRIBE").
+		Path("/event/{service:[0-9]+}").
+		Name(EventRoute).
+		HandlerFunc(dev.handleEvents).
+		GetError()
 
 	return
 }
@@ -132,7 +142,7 @@ func (d *device) AddIcon(icon Icon) {
 
 func (d *device) AddService(s *Service) (err error) {
 	idx := len(d.Services)
-	desc := &serviceDesc{ID: s.id, URN: s.urn, service: s, EventSubURL: "/sub"}
+	desc := &serviceDesc{ID: s.id, URN: s.urn, service: s}
 	d.Services = append(d.Services, desc)
 
 	url, err := d.router.Get(ControlRoute).URLPath()
@@ -147,6 +157,12 @@ func (d *device) AddService(s *Service) (err error) {
 	}
 	desc.SCPDURL = url.String()
 
+	url, err = d.router.Get(EventRoute).URLPath("service", strconv.Itoa(idx))
+	if err != nil {
+		return
+	}
+	desc.EventSubURL = url.String()
+
 	urns, err := ExpandTypes(s.urn)
 	if err != nil {
 		return
@@ -213,12 +229,27 @@ func (d *device) describeDevice(w http.ResponseWriter, r *http.Request) {
 }
 
 func (d *device) describeService(w http.ResponseWriter, r *http.Request) {
-	idx, err := strconv.Atoi(mux.Vars(r)["service"])
-	if err != nil {
+	if s := d.findService(r); s != nil {
+		d.serveXML(w, r, s)
+	} else {
 		http.Error(w, "Unknown service", http.StatusNotFound)
-		return
 	}
-	d.serveXML(w, r, d.Services[idx].service)
+}
+
+func (d *device) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s := d.findService(r); s != nil {
+		s.events.ServeHTTP(w, r)
+	} else {
+		http.Error(w, "Unknown service", http.StatusNotFound)
+	}
+}
+
+func (d *device) findService(r *http.Request) *Service {
+	idx, err := strconv.Atoi(mux.Vars(r)["service"])
+	if err != nil || idx < 0 || idx >= len(d.Services) {
+		return nil
+	}
+	return d.Services[idx].service
 }
 
 var bufferPool = buffer.NewPool()
@@ -0,0 +1,396 @@
+package upnp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adirelle/go-libs/logging"
+	"github.com/satori/go.uuid"
+)
+
+// See section 4 of the UPnP Device Architecture 1.0 for reference
+
+const (
+	// DefaultSubscriptionTimeout is used when the control point does not request a specific timeout
+	DefaultSubscriptionTimeout = 30 * time.Minute
+	// MinSubscriptionTimeout is the shortest subscription duration we accept
+	MinSubscriptionTimeout = time.Minute
+	// MaxSubscriptionTimeout is the longest subscription duration we accept
+	MaxSubscriptionTimeout = 24 * time.Hour
+
+	// EventModerationInterval is the minimum delay between two events sent to the same subscriber
+	EventModerationInterval = 2 * time.Second
+
+	notifyTimeout = 30 * time.Second
+)
+
+// StateVariableFunc returns the current value of a state variable
+type StateVariableFunc func() string
+
+type eventedVariable struct {
+	name  string
+	value StateVariableFunc
+}
+
+// eventPublisher handles subscriptions to the evented state variables of a service
+type eventPublisher struct {
+	variables     []eventedVariable
+	subscriptions map[string]*subscription
+	client        *http.Client
+	mu            sync.Mutex
+}
+
+func newEventPublisher() *eventPublisher {
+	return &eventPublisher{
+		subscriptions: make(map[string]*subscription),
+		client:        &http.Client{Timeout: notifyTimeout},
+	}
+}
+
+func (p *eventPublisher) addVariable(name string, value StateVariableFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.variables = append(p.variables, eventedVariable{name, value})
+}
+
+// notify schedules an event for the given variables to every subscriber
+func (p *eventPublisher) notify(names ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sub := range p.subscriptions {
+		sub.enqueue(names)
+	}
+}
+
+func (p *eventPublisher) variableNames() []string {
+	names := make([]string, len(p.variables))
+	for i, v := range p.variables {
+		names[i] = v.name
+	}
+	return names
+}
+
+// propertySet builds the NOTIFY body for the given variables
+func (p *eventPublisher) propertySet(names []string) ([]byte, error) {
+	p.mu.Lock()
+	vars := p.variables
+	p.mu.Unlock()
+
+	set := propertySet{XMLNS: "urn:schemas-upnp-org:event-1-0"}
+	for _, v := range vars {
+		for _, name := range names {
+			if name == v.name {
+				set.Properties = append(set.Properties, property{
+					Value: propertyValue{XMLName: xml.Name{Local: v.name}, Value: v.value()},
+				})
+				break
+			}
+		}
+	}
+
+	b := bytes.NewBufferString(xml.Header)
+	err := xml.NewEncoder(b).Encode(set)
+	return b.Bytes(), err
+}
+
+type propertySet struct {
+	XMLName    xml.Name   `xml:"e:propertyset"`
+	XMLNS      string     `xml:"xmlns:e,attr"`
+	Properties []property `xml:"e:property"`
+}
+
+type property struct {
+	Value propertyValue
+}
+
+type propertyValue struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// ServeHTTP handles SUBSCRIBE and UNSUBSCRIBE requests
+func (p *eventPublisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l := logging.MustFromContext(r.Context()).Named("gena")
+	sid := r.Header.Get("SID")
+	callback := r.Header.Get("CALLBACK")
+	nt := r.Header.Get("NT")
+
+	switch r.Method {
+	case "SUBSCRIBE":
+		if sid != "" && (callback != "" || nt != "") {
+			http.Error(w, "Incompatible header fields", http.StatusBadRequest)
+		} else if sid != "" {
+			p.renew(w, r, sid)
+		} else if nt != "upnp:event" {
+			http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		} else {
+			p.subscribe(w, r, callback, l)
+		}
+
+	case "UNSUBSCRIBE":
+		if callback != "" || nt != "" {
+			http.Error(w, "Incompatible header fields", http.StatusBadRequest)
+		} else if !p.unsubscribe(sid) {
+			http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		}
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *eventPublisher) subscribe(w http.ResponseWriter, r *http.Request, callback string, l logging.Logger) {
+	callbacks, err := parseCallbacks(callback)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	sid := fmt.Sprintf("uuid:%s", uuid.NewV4())
+	sub := &subscription{
+		sid:       sid,
+		callbacks: callbacks,
+		publisher: p,
+		pending:   make(map[string]bool),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		l:         l.With("sid", sid),
+	}
+	timeout := parseTimeout(r.Header.Get("TIMEOUT"))
+
+	p.mu.Lock()
+	p.subscriptions[sub.sid] = sub
+	sub.renew(timeout)
+	sub.enqueue(p.variableNames())
+	p.mu.Unlock()
+
+	sub.l.Infof("subscribed for %s, callbacks: %v", timeout, callbacks)
+	writeSubscriptionHeaders(w, sub.sid, timeout)
+	w.WriteHeader(http.StatusOK)
+	if fl, ok := w.(http.Flusher); ok {
+		fl.Flush()
+	}
+
+	// The initial event must be sent after the response
+	go sub.run()
+}
+
+func (p *eventPublisher) renew(w http.ResponseWriter, r *http.Request, sid string) {
+	timeout := parseTimeout(r.Header.Get("TIMEOUT"))
+
+	p.mu.Lock()
+	sub, found := p.subscriptions[sid]
+	if found {
+		sub.renew(timeout)
+	}
+	p.mu.Unlock()
+
+	if !found {
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		return
+	}
+	sub.l.Debugf("renewed for %s", timeout)
+	writeSubscriptionHeaders(w, sid, timeout)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *eventPublisher) unsubscribe(sid string) bool {
+	p.mu.Lock()
+	sub, found := p.subscriptions[sid]
+	if found {
+		p.remove(sub)
+	}
+	p.mu.Unlock()
+	if found {
+		sub.l.Info("unsubscribed")
+	}
+	return found
+}
+
+// remove must be called with p.mu locked
+func (p *eventPublisher) remove(sub *subscription) {
+	if p.subscriptions[sub.sid] == sub {
+		delete(p.subscriptions, sub.sid)
+		sub.stop()
+	}
+}
+
+func (p *eventPublisher) expire(sub *subscription) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().Before(sub.expiresAt) {
+		// Renewed in the meantime
+		return
+	}
+	p.remove(sub)
+	sub.l.Info("expired")
+}
+
+func writeSubscriptionHeaders(w http.ResponseWriter, sid string, timeout time.Duration) {
+	h := w.Header()
+	h.Set("SID", sid)
+	h.Set("TIMEOUT", fmt.Sprintf("Second-%d", timeout/time.Second))
+	h.Set("Content-Length", "0")
+}
+
+var callbackRe = regexp.MustCompile(`<([^>]+)>`)
+
+func parseCallbacks(header string) (urls []*url.URL, err error) {
+	for _, m := range callbackRe.FindAllStringSubmatch(header, -1) {
+		var u *url.URL
+		u, err = url.Parse(m[1])
+		if err != nil {
+			return
+		}
+		if u.Scheme == "http" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		err = fmt.Errorf("no valid callback URL in %q", header)
+	}
+	return
+}
+
+func parseTimeout(header string) time.Duration {
+	if !strings.HasPrefix(header, "Second-") {
+		return DefaultSubscriptionTimeout
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(header, "Second-"), 10, 32)
+	if err != nil {
+		// Includes "infinite"
+		return DefaultSubscriptionTimeout
+	}
+	timeout := time.Duration(n) * time.Second
+	if timeout < MinSubscriptionTimeout {
+		return MinSubscriptionTimeout
+	} else if timeout > MaxSubscriptionTimeout {
+		return MaxSubscriptionTimeout
+	}
+	return timeout
+}
+
+// subscription holds the state of one subscriber, including its queue of pending changes
+type subscription struct {
+	sid       string
+	callbacks []*url.URL
+	publisher *eventPublisher
+	seq       uint32
+	expiry    *time.Timer
+	expiresAt time.Time
+
+	pending map[string]bool
+	wake    chan struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+
+	l logging.Logger
+}
+
+// renew must be called with the publisher lock held
+func (s *subscription) renew(timeout time.Duration) {
+	if s.expiry != nil {
+		s.expiry.Stop()
+	}
+	s.expiresAt = time.Now().Add(timeout)
+	s.expiry = time.AfterFunc(timeout, func() { s.publisher.expire(s) })
+}
+
+func (s *subscription) stop() {
+	if s.expiry != nil {
+		s.expiry.Stop()
+	}
+	close(s.done)
+}
+
+func (s *subscription) enqueue(names []string) {
+	s.mu.Lock()
+	for _, name := range names {
+		s.pending[name] = true
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) dequeue() (names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.pending {
+		names = append(names, name)
+	}
+	s.pending = make(map[string]bool)
+	return
+}
+
+// run delivers the pending changes until the subscription ends
+func (s *subscription) run() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+		if names := s.dequeue(); len(names) > 0 {
+			s.send(names)
+		}
+		select {
+		case <-time.After(EventModerationInterval):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *subscription) send(names []string) {
+	body, err := s.publisher.propertySet(names)
+	if err != nil {
+		s.l.Errorf("cannot build event: %s", err)
+		return
+	}
+	seq := s.seq
+	// SEQ wraps to 1, 0 is reserved for the initial event
+	if s.seq == ^uint32(0) {
+		s.seq = 1
+	} else {
+		s.seq++
+	}
+	for _, cb := range s.callbacks {
+		if err = s.sendTo(cb, seq, body); err == nil {
+			s.l.Debugf("sent event #%d to %s: %v", seq, cb, names)
+			return
+		}
+		s.l.Warnf("could not send event #%d to %s: %s", seq, cb, err)
+	}
+}
+
+func (s *subscription) sendTo(cb *url.URL, seq uint32, body []byte) error {
+	req, err := http.NewRequest("NOTIFY", cb.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("NT", "upnp:event")
+	req.Header.Set("NTS", "upnp:propchange")
+	req.Header.Set("SID", s.sid)
+	req.Header.Set("SEQ", strconv.FormatUint(uint64(seq), 10))
+	res, err := s.publisher.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package upnp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adirelle/go-libs/logging"
+)
+
+func TestParseTimeout(t *testing.T) {
+	var data = map[string]time.Duration{
+		"":                DefaultSubscriptionTimeout,
+		"Second-infinite": DefaultSubscriptionTimeout,
+		"Second-abc":      DefaultSubscriptionTimeout,
+		"Second-300":      300 * time.Second,
+		"Second-5":        MinSubscriptionTimeout,
+		"Second-999999":   MaxSubscriptionTimeout,
+	}
+	for input, expected := range data {
+		if actual := parseTimeout(input); actual != expected {
+			t.Errorf("parseTimeout(%q), expected %s, got %s", input, expected, actual)
+		}
+	}
+}
+
+func TestParseCallbacks(t *testing.T) {
+	urls, err := parseCallbacks("<http://10.0.0.1:1234/a><ftp://10.0.0.1/b> <http://10.0.0.2/c>")
+	if err != nil || len(urls) != 2 || urls[0].String() != "http://10.0.0.1:1234/a" || urls[1].String() != "http://10.0.0.2/c" {
+		t.Errorf("expected the two HTTP callbacks, got %v, %v", urls, err)
+	}
+	for _, header := range []string{"", "http://10.0.0.1/a", "<ftp://10.0.0.1/b>"} {
+		if _, err := parseCallbacks(header); err == nil {
+			t.Errorf("parseCallbacks(%q), expected an error", header)
+		}
+	}
+}
+
+// event is a NOTIFY request received by the test callback
+type event struct {
+	sid, seq, body string
+}
+
+func TestEventSubscription(t *testing.T) {
+	events := make(chan event, 10)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "NOTIFY" || r.Header.Get("NT") != "upnp:event" || r.Header.Get("NTS") != "upnp:propchange" {
+			t.Errorf("unexpected request: %s %v", r.Method, r.Header)
+		}
+		var body strings.Builder
+		buf := make([]byte, 1024)
+		for {
+			n, err := r.Body.Read(buf)
+			body.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		events <- event{r.Header.Get("SID"), r.Header.Get("SEQ"), body.String()}
+	}))
+	defer callback.Close()
+
+	p := newEventPublisher()
+	value := "1"
+	p.addVariable("Counter", func() string { return value })
+	l := logging.NewTesting(t)
+	do := func(method string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/events", nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		r = r.WithContext(logging.WithLogger(r.Context(), l))
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+	receive := func(expectedSeq string) event {
+		select {
+		case e := <-events:
+			if e.seq != expectedSeq {
+				t.Errorf("expected SEQ %s, got %s", expectedSeq, e.seq)
+			}
+			return e
+		case <-time.After(EventModerationInterval + 5*time.Second):
+			t.Fatalf("event #%s not received", expectedSeq)
+		}
+		return event{}
+	}
+
+	if w := do("SUBSCRIBE", "CALLBACK", "<"+callback.URL+">"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("SUBSCRIBE without NT, expected 412, got %d", w.Code)
+	}
+	if w := do("SUBSCRIBE", "NT", "upnp:event", "CALLBACK", "invalid"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("SUBSCRIBE without valid callback, expected 412, got %d", w.Code)
+	}
+
+	w := do("SUBSCRIBE", "NT", "upnp:event", "CALLBACK", "<"+callback.URL+"/notify>", "TIMEOUT", "Second-300")
+	sid := w.Header().Get("SID")
+	if w.Code != http.StatusOK || !strings.HasPrefix(sid, "uuid:") || w.Header().Get("TIMEOUT") != "Second-300" {
+		t.Fatalf("SUBSCRIBE, unexpected response: %d %v", w.Code, w.Header())
+	}
+
+	// The initial event holds all the variables
+	if e := receive("0"); e.sid != sid || !strings.Contains(e.body, "<Counter>1</Counter>") {
+		t.Errorf("unexpected initial event: %+v", e)
+	}
+	value = "2"
+	p.notify("Counter")
+	if e := receive("1"); !strings.Contains(e.body, "<Counter>2</Counter>") {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	if w := do("SUBSCRIBE", "SID", sid, "NT", "upnp:event"); w.Code != http.StatusBadRequest {
+		t.Errorf("renewal with NT, expected 400, got %d", w.Code)
+	}
+	if w := do("SUBSCRIBE", "SID", "uuid:unknown", "TIMEOUT", "Second-300"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("renewal of an unknown subscription, expected 412, got %d", w.Code)
+	}
+	w = do("SUBSCRIBE", "SID", sid, "TIMEOUT", "Second-5")
+	if w.Code != http.StatusOK || w.Header().Get("SID") != sid || w.Header().Get("TIMEOUT") != "Second-60" {
+		t.Errorf("renewal, unexpected response: %d %v", w.Code, w.Header())
+	}
+
+	if w := do("UNSUBSCRIBE", "SID", sid, "CALLBACK", "<"+callback.URL+">"); w.Code != http.StatusBadRequest {
+		t.Errorf("UNSUBSCRIBE with CALLBACK, expected 400, got %d", w.Code)
+	}
+	if w := do("UNSUBSCRIBE", "SID", sid); w.Code != http.StatusOK {
+		t.Errorf("UNSUBSCRIBE, expected 200, got %d", w.Code)
+	}
+	if w := do("UNSUBSCRIBE", "SID", sid); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("second UNSUBSCRIBE, expected 412, got %d", w.Code)
+	}
+	p.notify("Counter")
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event after UNSUBSCRIBE: %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -27,6 +27,7 @@ type Service struct {
 	logger  logging.Logger
 	actions map[string]Action
 	varMap  map[string]stateVariableDesc
+	events  *eventPublisher
 }
 
 type actionDesc struct {
@@ -54,10 +55,40 @@ func NewService(id, urn string) *Service {
 		urn:         urn,
 		actions:     make(map[string]Action),
 		varMap:      make(map[string]stateVariableDesc),
+		events:      newEventPublisher(),
 		SpecVersion: specVersion{1, 0},
 	}
 }
 
+// AddEventedVariable declares an evented state variable, or marks an existing one as evented.
+// value is called to get the current value of the variable each time an event is sent.
+func (s *Service) AddEventedVariable(name, dataType string, value StateVariableFunc) error {
+	stateVar, exists := s.varMap[name]
+	if !exists {
+		stateVar = stateVariableDesc{Name: name, DataType: dataType}
+	} else if stateVar.DataType != dataType {
+		return fmt.Errorf("state variable %q already declared with type %s", name, stateVar.DataType)
+	}
+	stateVar.SendEvents = "yes"
+	s.varMap[name] = stateVar
+	if exists {
+		for i, v := range s.ServiceStateTable {
+			if v.Name == name {
+				s.ServiceStateTable[i] = stateVar
+			}
+		}
+	} else {
+		s.ServiceStateTable = append(s.ServiceStateTable, stateVar)
+	}
+	s.events.addVariable(name, value)
+	return nil
+}
+
+// Notify sends the current values of the named evented state variables to the subscribers.
+func (s *Service) Notify(names ...string) {
+	s.events.notify(names...)
+}
+
 // AddAction adds a new action the service specs.
 func (s *Service) AddAction(name string, action Action) (err error) {
 	if _, exists := s.actions[name]; exists {